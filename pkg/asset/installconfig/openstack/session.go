@@ -35,6 +35,30 @@ func GetSession(cloudName string) (*Session, error) {
 	}, nil
 }
 
+// GetTrustID returns the Keystone trust ID set for a given cloud name in
+// clouds.yaml, or an empty string when the cloud doesn't use a trust. The
+// clientconfig library doesn't parse the trust_id setting, so it is read
+// directly from the file.
+func GetTrustID(cloudName string) (string, error) {
+	content, err := loadAndLog(clientconfig.FindAndReadCloudsYAML)
+	if err != nil {
+		return "", err
+	}
+
+	var clouds struct {
+		Clouds map[string]struct {
+			Auth struct {
+				TrustID string `json:"trust_id"`
+			} `json:"auth"`
+		} `json:"clouds"`
+	}
+	if err := yaml.Unmarshal(content, &clouds); err != nil {
+		return "", fmt.Errorf("failed to unmarshal yaml: %w", err)
+	}
+
+	return clouds.Clouds[cloudName].Auth.TrustID, nil
+}
+
 type yamlLoadOpts struct{}
 
 func (opts yamlLoadOpts) LoadCloudsYAML() (map[string]clientconfig.Cloud, error) {
@@ -0,0 +1,36 @@
+package openstack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTrustID(t *testing.T) {
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	err := os.WriteFile(cloudsYAML, []byte(`clouds:
+  trusted:
+    auth:
+      auth_url: https://my_auth_url.com/v3/
+      username: my_trustee
+      password: my_secret_password
+      trust_id: 0f1e2d3c4b5a69788796a5b4c3d2e1f0
+  untrusted:
+    auth:
+      auth_url: https://my_auth_url.com/v3/
+      username: my_user
+      password: my_secret_password
+`), 0o600)
+	assert.NoError(t, err)
+	t.Setenv("OS_CLIENT_CONFIG_FILE", cloudsYAML)
+
+	trustID, err := GetTrustID("trusted")
+	assert.NoError(t, err)
+	assert.Equal(t, "0f1e2d3c4b5a69788796a5b4c3d2e1f0", trustID)
+
+	trustID, err = GetTrustID("untrusted")
+	assert.NoError(t, err)
+	assert.Empty(t, trustID)
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/gophercloud/utils/openstack/clientconfig"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/yaml"
 
@@ -19,6 +21,7 @@ import (
 	installconfigaws "github.com/openshift/installer/pkg/asset/installconfig/aws"
 	"github.com/openshift/installer/pkg/asset/installconfig/gcp"
 	"github.com/openshift/installer/pkg/asset/installconfig/ibmcloud"
+	installconfigopenstack "github.com/openshift/installer/pkg/asset/installconfig/openstack"
 	"github.com/openshift/installer/pkg/asset/installconfig/ovirt"
 	"github.com/openshift/installer/pkg/asset/machines"
 	osmachine "github.com/openshift/installer/pkg/asset/machines/openstack"
@@ -84,6 +87,7 @@ func (o *Openshift) Generate(dependencies asset.Parents) error {
 	featureGate := &FeatureGate{}
 	dependencies.Get(installConfig, kubeadminPassword, clusterID, openshiftInstall, featureGate)
 	var cloudCreds cloudCredsSecretData
+	var openstackCredsSecret []byte
 	platform := installConfig.Config.Platform.Name()
 	switch platform {
 	case awstypes.Name:
@@ -156,43 +160,23 @@ func (o *Openshift) Generate(dependencies asset.Parents) error {
 			return err
 		}
 
-		// We need to replace the local cacert path with one that is used in OpenShift
-		if cloud.CACertFile != "" {
-			cloud.CACertFile = "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem"
-		}
-
-		// Application credentials are easily rotated in the event of a leak and should be preferred. Encourage their use.
-		authTypes := sets.New(clientconfig.AuthPassword, clientconfig.AuthV2Password, clientconfig.AuthV3Password)
-		if cloud.AuthInfo != nil && authTypes.Has(cloud.AuthType) {
-			logrus.Warnf(
-				"clouds.yaml file is using %q type auth. Consider using the %q auth type instead to rotate credentials more easily.",
-				cloud.AuthType,
-				clientconfig.AuthV3ApplicationCredential,
-			)
-		}
-
-		clouds := make(map[string]map[string]*clientconfig.Cloud)
-		clouds["clouds"] = map[string]*clientconfig.Cloud{
-			osmachine.CloudName: cloud,
-		}
-
-		marshalled, err := yaml.Marshal(clouds)
+		trustID, err := installconfigopenstack.GetTrustID(opts.Cloud)
 		if err != nil {
 			return err
 		}
 
-		cloudProviderConf, err := openstackmanifests.CloudProviderConfigSecret(cloud)
+		creds, err := openstackCredsSecretData(cloud, installConfig.Config.Platform.OpenStack, trustID)
 		if err != nil {
 			return err
 		}
-
-		credsEncoded := base64.StdEncoding.EncodeToString(marshalled)
-		credsINIEncoded := base64.StdEncoding.EncodeToString(cloudProviderConf)
 		cloudCreds = cloudCredsSecretData{
-			OpenStack: &OpenStackCredsSecretData{
-				Base64encodeCloudCreds:    credsEncoded,
-				Base64encodeCloudCredsINI: credsINIEncoded,
-			},
+			OpenStack: creds,
+		}
+		if installConfig.Config.CredentialsMode != types.ManualCredentialsMode {
+			openstackCredsSecret, err = openstackCredentialsSecret(installConfig.Config.Platform.OpenStack.CloudProviderConfig, creds)
+			if err != nil {
+				return err
+			}
 		}
 	case vspheretypes.Name:
 		vsphereCredList := make([]*VSphereCredsSecretData, 0)
@@ -262,6 +246,9 @@ func (o *Openshift) Generate(dependencies asset.Parents) error {
 			assetData["99_cloud-creds-secret.yaml"] = applyTemplateData(cloudCredsSecret.Files()[0].Data, templateData)
 		}
 		assetData["99_role-cloud-creds-secret-reader.yaml"] = applyTemplateData(roleCloudCredsSecretReader.Files()[0].Data, templateData)
+		if len(openstackCredsSecret) > 0 {
+			assetData["99_openstack-cloud-provider-creds-secret.yaml"] = openstackCredsSecret
+		}
 	case baremetaltypes.Name:
 		bmTemplateData := baremetalTemplateData{
 			Baremetal:                 installConfig.Config.Platform.BareMetal,
@@ -353,3 +340,98 @@ func (o *Openshift) Load(f asset.FileFetcher) (bool, error) {
 	asset.SortFiles(o.FileList)
 	return len(o.FileList) > 0, nil
 }
+
+// openstackCredsSecretData returns the credentials of the given cloud, both as
+// clouds.yaml and as the INI config of the cloud provider, as the components of
+// the cluster read them.
+func openstackCredsSecretData(cloud *clientconfig.Cloud, platform *openstacktypes.Platform, trustID string) (*OpenStackCredsSecretData, error) {
+	copied := *cloud
+	cloud = &copied
+
+	// We need to replace the local cacert path with one that is used in OpenShift.
+	// The CA bundle of the install config is mounted at the same path.
+	config := platform.CloudProviderConfig
+	if cloud.CACertFile != "" || (config != nil && config.CABundle != "") {
+		cloud.CACertFile = openstackmanifests.CABundleMountPath
+	}
+	// The identity API version pinned in the install config stands for the
+	// identity_api_version of clouds.yaml, as in the cloud provider config.
+	if config != nil && config.IdentityAPIVersion != "" {
+		cloud.IdentityAPIVersion = config.IdentityAPIVersion
+	}
+
+	// Application credentials are easily rotated in the event of a leak and should be preferred. Encourage their use.
+	authTypes := sets.New(clientconfig.AuthPassword, clientconfig.AuthV2Password, clientconfig.AuthV3Password)
+	if cloud.AuthInfo != nil && authTypes.Has(cloud.AuthType) {
+		logrus.Warnf(
+			"clouds.yaml file is using %q type auth. Consider using the %q auth type instead to rotate credentials more easily.",
+			cloud.AuthType,
+			clientconfig.AuthV3ApplicationCredential,
+		)
+	}
+
+	clouds := make(map[string]map[string]*clientconfig.Cloud)
+	clouds["clouds"] = map[string]*clientconfig.Cloud{
+		osmachine.CloudName: cloud,
+	}
+
+	marshalled, err := yaml.Marshal(clouds)
+	if err != nil {
+		return nil, err
+	}
+
+	secretOpts := []openstackmanifests.Option{openstackmanifests.WithTrustID(trustID)}
+	if config != nil {
+		secretOpts = append(secretOpts, openstackmanifests.WithRegion(config.Region))
+	}
+	cloudProviderConf, err := openstackmanifests.CloudProviderConfigSecret(cloud, secretOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OpenStackCredsSecretData{
+		Base64encodeCloudCreds:    base64.StdEncoding.EncodeToString(marshalled),
+		Base64encodeCloudCredsINI: base64.StdEncoding.EncodeToString(cloudProviderConf),
+	}, nil
+}
+
+// openstackCredentialsSecret returns the manifest of a copy of the credentials
+// secret under the name and the namespace the cloud provider config references,
+// or nothing when it references the secret created from the cloud creds.
+func openstackCredentialsSecret(config *openstacktypes.CloudProviderConfig, creds *OpenStackCredsSecretData) ([]byte, error) {
+	name, namespace, err := openstackmanifests.CredentialsSecret(config)
+	if err != nil {
+		return nil, err
+	}
+	defaultName, defaultNamespace, _ := openstackmanifests.CredentialsSecret(nil)
+	if name == defaultName && namespace == defaultNamespace {
+		return nil, nil
+	}
+	if namespace != defaultNamespace {
+		logrus.Warnf("The OpenStack cloud provider reads its credentials from the %s namespace, which must be created by a manifest if it isn't part of OpenShift.", namespace)
+	}
+
+	cloudsYAML, err := base64.StdEncoding.DecodeString(creds.Base64encodeCloudCreds)
+	if err != nil {
+		return nil, err
+	}
+	cloudsConf, err := base64.StdEncoding.DecodeString(creds.Base64encodeCloudCredsINI)
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: corev1.SchemeGroupVersion.String(),
+			Kind:       "Secret",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			"clouds.yaml": cloudsYAML,
+			"clouds.conf": cloudsConf,
+		},
+	}
+	return yaml.Marshal(secret)
+}
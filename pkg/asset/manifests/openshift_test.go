@@ -0,0 +1,205 @@
+package manifests
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	osmachine "github.com/openshift/installer/pkg/asset/machines/openstack"
+	openstackmanifests "github.com/openshift/installer/pkg/asset/manifests/openstack"
+	openstacktypes "github.com/openshift/installer/pkg/types/openstack"
+)
+
+func TestOpenStackCredsSecretDataCACert(t *testing.T) {
+	cases := []struct {
+		name           string
+		caCertFile     string
+		caBundle       string
+		expectedCACert string
+	}{
+		{
+			name: "no CA",
+		},
+		{
+			name:           "clouds.yaml cacert",
+			caCertFile:     "/home/user/ca.pem",
+			expectedCACert: openstackmanifests.CABundleMountPath,
+		},
+		{
+			name:           "inline CA without clouds.yaml cacert",
+			caBundle:       base64.StdEncoding.EncodeToString([]byte("-----BEGIN CERTIFICATE-----\n")),
+			expectedCACert: openstackmanifests.CABundleMountPath,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := &clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{
+					AuthURL:                     "https://keystone.example.com:5000/v3",
+					ApplicationCredentialID:     "app-cred-id",
+					ApplicationCredentialSecret: "app-cred-secret",
+				},
+				CACertFile: tc.caCertFile,
+			}
+			platform := &openstacktypes.Platform{
+				CloudProviderConfig: &openstacktypes.CloudProviderConfig{CABundle: tc.caBundle},
+			}
+
+			creds, err := openstackCredsSecretData(cloud, platform, "")
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.caCertFile, cloud.CACertFile, "the cloud of the caller must be left untouched")
+
+			cloudsYAML, err := base64.StdEncoding.DecodeString(creds.Base64encodeCloudCreds)
+			assert.NoError(t, err)
+			var clouds clientconfig.Clouds
+			assert.NoError(t, yaml.Unmarshal(cloudsYAML, &clouds))
+			assert.Equal(t, tc.expectedCACert, clouds.Clouds[osmachine.CloudName].CACertFile)
+
+			ini, err := base64.StdEncoding.DecodeString(creds.Base64encodeCloudCredsINI)
+			assert.NoError(t, err)
+			if tc.expectedCACert == "" {
+				assert.NotContains(t, string(ini), "ca-file")
+				return
+			}
+			assert.Contains(t, string(ini), `ca-file = "`+tc.expectedCACert+`"`)
+		})
+	}
+}
+
+func TestOpenStackCredsSecretDataIdentityAPIVersion(t *testing.T) {
+	cases := []struct {
+		name            string
+		cloudVersion    string
+		configVersion   string
+		expectedVersion string
+		expectedAuthURL string
+	}{
+		{
+			name:            "not pinned",
+			cloudVersion:    "3",
+			expectedVersion: "3",
+			expectedAuthURL: "https://keystone.example.com:5000/v3",
+		},
+		{
+			name:            "pinned in the install config",
+			configVersion:   "3",
+			expectedVersion: "3",
+			expectedAuthURL: "https://keystone.example.com:5000/v3",
+		},
+		{
+			name:            "install config overrides clouds.yaml",
+			cloudVersion:    "2",
+			configVersion:   "3",
+			expectedVersion: "3",
+			expectedAuthURL: "https://keystone.example.com:5000/v3",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := &clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{
+					AuthURL:                     "https://keystone.example.com:5000",
+					ApplicationCredentialID:     "app-cred-id",
+					ApplicationCredentialSecret: "app-cred-secret",
+				},
+				IdentityAPIVersion: tc.cloudVersion,
+			}
+			platform := &openstacktypes.Platform{
+				CloudProviderConfig: &openstacktypes.CloudProviderConfig{IdentityAPIVersion: tc.configVersion},
+			}
+
+			creds, err := openstackCredsSecretData(cloud, platform, "")
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tc.cloudVersion, cloud.IdentityAPIVersion, "the cloud of the caller must be left untouched")
+
+			cloudsYAML, err := base64.StdEncoding.DecodeString(creds.Base64encodeCloudCreds)
+			assert.NoError(t, err)
+			var clouds clientconfig.Clouds
+			assert.NoError(t, yaml.Unmarshal(cloudsYAML, &clouds))
+			assert.Equal(t, tc.expectedVersion, clouds.Clouds[osmachine.CloudName].IdentityAPIVersion)
+
+			ini, err := base64.StdEncoding.DecodeString(creds.Base64encodeCloudCredsINI)
+			assert.NoError(t, err)
+			assert.Contains(t, string(ini), `auth-url = "`+tc.expectedAuthURL+`"`)
+		})
+	}
+}
+
+func TestOpenStackCredentialsSecret(t *testing.T) {
+	creds := &OpenStackCredsSecretData{
+		Base64encodeCloudCreds:    base64.StdEncoding.EncodeToString([]byte("clouds: {}\n")),
+		Base64encodeCloudCredsINI: base64.StdEncoding.EncodeToString([]byte("[Global]\n")),
+	}
+
+	cases := []struct {
+		name              string
+		config            *openstacktypes.CloudProviderConfig
+		expectedName      string
+		expectedNamespace string
+		expectedError     string
+	}{
+		{
+			name: "default secret",
+		},
+		{
+			name:   "default secret set explicitly",
+			config: &openstacktypes.CloudProviderConfig{SecretName: "openstack-credentials", SecretNamespace: "kube-system"},
+		},
+		{
+			name:              "custom name",
+			config:            &openstacktypes.CloudProviderConfig{SecretName: "my-credentials"},
+			expectedName:      "my-credentials",
+			expectedNamespace: "kube-system",
+		},
+		{
+			name:              "custom namespace",
+			config:            &openstacktypes.CloudProviderConfig{SecretNamespace: "openshift-config"},
+			expectedName:      "openstack-credentials",
+			expectedNamespace: "openshift-config",
+		},
+		{
+			name:          "invalid name",
+			config:        &openstacktypes.CloudProviderConfig{SecretName: "My_Credentials"},
+			expectedError: "invalid secret-name",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := openstackCredentialsSecret(tc.config, creds)
+			if tc.expectedError != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.expectedError)
+				}
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			if tc.expectedName == "" {
+				assert.Empty(t, data)
+				return
+			}
+
+			var secret corev1.Secret
+			if !assert.NoError(t, yaml.Unmarshal(data, &secret)) {
+				return
+			}
+			assert.Equal(t, "Secret", secret.Kind)
+			assert.Equal(t, tc.expectedName, secret.Name)
+			assert.Equal(t, tc.expectedNamespace, secret.Namespace)
+			assert.Equal(t, "clouds: {}\n", string(secret.Data["clouds.yaml"]))
+			assert.Equal(t, "[Global]\n", string(secret.Data["clouds.conf"]))
+		})
+	}
+}
@@ -1,16 +1,36 @@
 package openstack
 
 import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/gophercloud/gophercloud"
 	"github.com/gophercloud/utils/openstack/clientconfig"
-	networkutils "github.com/gophercloud/utils/openstack/networking/v2/networks"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	"github.com/openshift/installer/pkg/asset/installconfig/openstack"
 	"github.com/openshift/installer/pkg/types"
+	openstacktypes "github.com/openshift/installer/pkg/types/openstack"
 )
 
 // Error represents a failure while generating OpenStack provider
@@ -23,18 +43,371 @@ type Error struct {
 func (e Error) Error() string { return e.msg + ": " + e.err.Error() }
 func (e Error) Unwrap() error { return e.err }
 
+// Errors aggregates the failures found at once, for instance while validating
+// several fields, so that all of them can be reported together.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e Errors) Unwrap() []error { return e }
+
+var (
+	// ErrNetworkNotFound is the underlying error when no network matches the
+	// name of the external network.
+	ErrNetworkNotFound = errors.New("no network found")
+
+	// ErrAmbiguousNetwork is the underlying error when more than one network
+	// matches the name of the external network.
+	ErrAmbiguousNetwork = errors.New("more than one network found")
+)
+
+// defaultSecretName and defaultSecretNamespace locate the credentials secret
+// created by the installer. externalCCMSecretNamespace replaces the namespace
+// in the ExternalCCM layout.
+const (
+	defaultSecretName          = "openstack-credentials"
+	defaultSecretNamespace     = "kube-system"
+	externalCCMSecretNamespace = "openshift-cloud-controller-manager"
+)
+
+// CABundleMountPath is the path where the CA bundle of the cloud provider
+// config is mounted in the cluster, and the default value of ca-file.
+const CABundleMountPath = "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem"
+
+// defaultLookupRetries and defaultLookupRetryDelay bound the retries of the
+// Neutron lookups to about half a minute, which is enough to ride out the
+// restart of a Neutron server.
+const (
+	defaultLookupRetries    = 4
+	defaultLookupRetryDelay = 2 * time.Second
+)
+
+// minNodeVolumeAttachLimit and maxNodeVolumeAttachLimit bound the number of
+// volumes attached to a node to the range Nova supports.
+const (
+	minNodeVolumeAttachLimit = 1
+	maxNodeVolumeAttachLimit = 256
+)
+
+// defaultMaxCABundleSize is the default size limit of the CA bundle, which is
+// stored in a config map along with the cloud provider config: it stays below
+// the 1MiB object size limit of Kubernetes, with room left for the config.
+const defaultMaxCABundleSize = 1<<20 - 64<<10
+
+// CCMVersion identifies the generation of the OpenStack cloud provider the
+// configuration is written for.
+type CCMVersion int
+
+const (
+	// V1 is the legacy cloud provider, which reads the project from the
+	// tenant-id and tenant-name keys.
+	V1 CCMVersion = iota
+
+	// V2 is the cloud provider that reads the project from the project-id
+	// and project-name keys, and only accepts tenant-* as deprecated aliases.
+	V2
+)
+
+// Layout identifies where the cloud provider runs in the cluster, which
+// determines where it reads its credentials from.
+type Layout int
+
+const (
+	// InTree is the layout of the cloud provider running in the kube
+	// controller manager, which reads its credentials from kube-system.
+	InTree Layout = iota
+
+	// ExternalCCM is the layout of the external OpenStack cloud controller
+	// manager, which reads its credentials from its own namespace. It is a V2
+	// cloud provider, so it always gets the V2 key names.
+	ExternalCCM
+)
+
+// secretNamespace returns the default namespace of the credentials secret in
+// the layout.
+func (l Layout) secretNamespace() string {
+	if l == ExternalCCM {
+		return externalCCMSecretNamespace
+	}
+	return defaultSecretNamespace
+}
+
+// Option customizes the generated OpenStack provider configuration.
+type Option func(*options)
+
+type options struct {
+	trustID    string
+	tokenFile  string
+	caFile     string
+	cloudsFile string
+	cloudName  string
+	ccmVersion CCMVersion
+	layout     Layout
+
+	cloudsYAMLDir  string
+	inlineCABundle bool
+	maxCABundle    int
+	fsys           fs.FS
+	skipCABundle   bool
+
+	lookupRetries    int
+	lookupRetryDelay time.Duration
+	networkEndpoint  string
+
+	region           string
+	validateRegion   bool
+	strict           bool
+	normalizeAuthURL bool
+	preferProjectID  bool
+	header           []string
+
+	clusterAPI bool
+
+	inlineCredentials bool
+}
+
+// WithCCMVersion returns an option that selects the key names understood by
+// the given version of the cloud provider. The V1 key names are used by default,
+// except in the ExternalCCM layout.
+func WithCCMVersion(version CCMVersion) Option {
+	return func(o *options) {
+		o.ccmVersion = version
+	}
+}
+
+// WithCloudsFile returns an option that makes the cloud provider read its
+// credentials from the given entry of a clouds.yaml file mounted in the
+// cluster, instead of the credentials secret. The cloud of the install config
+// is used when the cloud name is empty.
+func WithCloudsFile(path, cloudName string) Option {
+	return func(o *options) {
+		o.cloudsFile = path
+		o.cloudName = cloudName
+	}
+}
+
+// WithCAFile returns an option that sets the path where the cloud provider
+// reads the CA bundle from. The same option must be given when generating the
+// secret and the config, so that both reference the same file.
+func WithCAFile(path string) Option {
+	return func(o *options) {
+		o.caFile = path
+	}
+}
+
+// WithLayout returns an option that writes the configuration for the given
+// layout of the cloud provider. The InTree layout is used by default.
+func WithLayout(layout Layout) Option {
+	return func(o *options) {
+		o.layout = layout
+	}
+}
+
+// WithTrustID returns an option that authenticates the cloud provider through
+// the given Keystone trust. An empty trust ID leaves the configuration unchanged.
+func WithTrustID(trustID string) Option {
+	return func(o *options) {
+		o.trustID = trustID
+	}
+}
+
+// WithTokenFile returns an option that makes the cloud provider authenticate
+// with the Keystone token read from the given file, for clusters whose
+// short-lived credentials are rotated by an external agent, such as a
+// projected service account token exchanged for a Keystone token. The static
+// secrets of the cloud are then left out of the credentials. The path, which
+// is read in the cluster, must be absolute. An empty path leaves the
+// configuration unchanged.
+func WithTokenFile(path string) Option {
+	return func(o *options) {
+		o.tokenFile = path
+	}
+}
+
+// WithCloudsYAMLDir returns an option that sets the directory of the local
+// clouds.yaml file, against which a relative ca-cert path is resolved.
+func WithCloudsYAMLDir(dir string) Option {
+	return func(o *options) {
+		o.cloudsYAMLDir = dir
+	}
+}
+
+// WithFS returns an option that reads the ca-cert file of clouds.yaml from the
+// given filesystem instead of the OS filesystem, for callers that hold
+// clouds.yaml and its CA bundle in memory. The ca-cert path and the directory
+// set by WithCloudsYAMLDir are then slash-separated paths of fsys, where a
+// leading slash is ignored.
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fsys = fsys
+	}
+}
+
+// WithInlineCABundle returns an option that leaves the ca-file setting out of
+// the cloud provider config. The CA bundle is still returned, so that the
+// caller can embed it wherever its pipeline expects it instead of mounting it
+// at the path given by WithCAFile.
+func WithInlineCABundle() Option {
+	return func(o *options) {
+		o.inlineCABundle = true
+	}
+}
+
+// WithNetworkEndpoint returns an option that sends the Neutron lookups done
+// while generating the config to the given endpoint instead of the one of the
+// service catalog, for split-horizon clouds where the installer can't reach the
+// endpoint the cluster uses. The config itself is left untouched: the cloud
+// provider keeps using the service catalog. The endpoint of the service catalog
+// is used by default.
+func WithNetworkEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.networkEndpoint = endpoint
+	}
+}
+
+// WithLookupRetries returns an option that sets how many times a Neutron lookup
+// failing with a transient error is retried, and the delay before the first
+// retry. The delay doubles with every retry.
+func WithLookupRetries(retries int, baseDelay time.Duration) Option {
+	return func(o *options) {
+		o.lookupRetries = retries
+		o.lookupRetryDelay = baseDelay
+	}
+}
+
+// WithRegion returns an option that overrides the region of the cloud in the
+// system secret. An empty region leaves the region of the cloud unchanged.
+func WithRegion(region string) Option {
+	return func(o *options) {
+		o.region = region
+	}
+}
+
+// WithRegionValidation returns an option that checks that the region of the
+// cloud provider config is one of the Keystone regions of the cloud, which
+// costs an API call on every generation. The check is skipped when no network
+// client is available. It is off by default.
+func WithRegionValidation(enabled bool) Option {
+	return func(o *options) {
+		o.validateRegion = enabled
+	}
+}
+
+// WithStrict returns an option that rejects the configurations where the
+// region of a cloud with several regions in clouds.yaml is left empty, which
+// makes the cloud provider pick one of them arbitrarily, and the auth URLs
+// that embed credentials, which are otherwise removed. Strict mode is off by
+// default.
+func WithStrict(strict bool) Option {
+	return func(o *options) {
+		o.strict = strict
+	}
+}
+
+// WithAuthURLNormalization returns an option that sets whether the auth URLs
+// are written in a canonical form: without trailing slash, and with the path of
+// the Keystone API version set by identity_api_version when the URL has none.
+// Some versions of the cloud provider fail to authenticate with some of the
+// forms Keystone accepts. Normalization is on by default.
+func WithAuthURLNormalization(enabled bool) Option {
+	return func(o *options) {
+		o.normalizeAuthURL = enabled
+	}
+}
+
+// WithProjectIDPrecedence returns an option that sets whether the project name
+// of the credentials is left out when their project ID is set. Some versions of
+// the cloud provider reject the credentials holding both as conflicting, while
+// the ID alone identifies the project. The ID takes precedence by default.
+func WithProjectIDPrecedence(enabled bool) Option {
+	return func(o *options) {
+		o.preferProjectID = enabled
+	}
+}
+
+// WithHeader returns an option that writes the given lines as comments at the
+// top of the cloud provider config, for instance to record its provenance. The
+// cloud provider ignores them. No header is written by default.
+func WithHeader(lines ...string) Option {
+	return func(o *options) {
+		o.header = lines
+	}
+}
+
+// WithClusterAPI returns an option that generates the cloud provider config
+// for the Cluster API OpenStack provider, which reads the credentials on its
+// own: the config doesn't reference the credentials secret nor the domain of
+// the credentials. It conflicts with WithInlineCredentials and WithCloudsFile.
+func WithClusterAPI() Option {
+	return func(o *options) {
+		o.clusterAPI = true
+	}
+}
+
+// WithInlineCredentials returns an option that writes the credentials of the
+// cloud in the cloud provider config, exactly like in the system secret,
+// instead of referencing the secret. This is meant for debugging only: the
+// cloud provider config is stored in a config map, which doesn't protect the
+// credentials, so this must never be used in production.
+func WithInlineCredentials() Option {
+	return func(o *options) {
+		o.inlineCredentials = true
+	}
+}
+
+// WithMaxCABundleSize returns an option that sets the size limit of the CA
+// bundle in bytes, past which the generation fails instead of the apply of
+// the config map. A limit of zero or less disables the check. The limit is
+// slightly under 1MiB by default.
+func WithMaxCABundleSize(size int) Option {
+	return func(o *options) {
+		o.maxCABundle = size
+	}
+}
+
+// withoutCABundle returns an option that skips reading the CA bundle, for the
+// callers that read it on their own.
+func withoutCABundle() Option {
+	return func(o *options) {
+		o.skipCABundle = true
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		caFile:           CABundleMountPath,
+		maxCABundle:      defaultMaxCABundleSize,
+		lookupRetries:    defaultLookupRetries,
+		lookupRetryDelay: defaultLookupRetryDelay,
+		normalizeAuthURL: true,
+		preferProjectID:  true,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
 // CloudProviderConfigSecret generates the cloud provider config for the OpenStack
 // platform, that will be stored in the system secret.
-func CloudProviderConfigSecret(cloud *clientconfig.Cloud) ([]byte, error) {
-	domainID := cloud.AuthInfo.DomainID
-	if domainID == "" {
-		domainID = cloud.AuthInfo.UserDomainID
+func CloudProviderConfigSecret(cloud *clientconfig.Cloud, opts ...Option) ([]byte, error) {
+	var res bytes.Buffer
+	if err := WriteCloudProviderConfigSecret(&res, cloud, opts...); err != nil {
+		return nil, err
 	}
+	return res.Bytes(), nil
+}
 
-	domainName := cloud.AuthInfo.DomainName
-	if domainName == "" {
-		domainName = cloud.AuthInfo.UserDomainName
-	}
+// WriteCloudProviderConfigSecret writes the cloud provider config for the
+// OpenStack platform that is stored in the system secret to w.
+func WriteCloudProviderConfigSecret(w io.Writer, cloud *clientconfig.Cloud, opts ...Option) error {
+	o := newOptions(opts)
 
 	// We have to generate this config manually without "go-ini" library, because its
 	// output data is incompatible with "gcfg".
@@ -42,87 +415,1429 @@ func CloudProviderConfigSecret(cloud *clientconfig.Cloud) ([]byte, error) {
 	// like `aaa#bbb`, but gcfg doesn't recognize it and  parses the data as `aaa, skipping
 	// everything after the #.
 	// For more information: https://bugzilla.redhat.com/show_bug.cgi?id=1771358
-	var res strings.Builder
-	res.WriteString("[Global]\n")
-	if cloud.AuthInfo.AuthURL != "" {
-		res.WriteString("auth-url = " + strconv.Quote(cloud.AuthInfo.AuthURL) + "\n")
+	global, err := secretGlobal(cloud, o)
+	if err != nil {
+		return err
 	}
-	if cloud.AuthInfo.Username != "" {
-		res.WriteString("username = " + strconv.Quote(cloud.AuthInfo.Username) + "\n")
+	body, err := global.render()
+	if err != nil {
+		return err
 	}
-	if cloud.AuthInfo.Password != "" {
-		res.WriteString("password = " + strconv.Quote(cloud.AuthInfo.Password) + "\n")
+
+	if _, err := io.WriteString(w, "[Global]\n"+body); err != nil {
+		return Error{err, "failed to write cloud provider config secret"}
 	}
-	if cloud.AuthInfo.ProjectID != "" {
-		res.WriteString("tenant-id = " + strconv.Quote(cloud.AuthInfo.ProjectID) + "\n")
+	return nil
+}
+
+// CloudProviderConfigSecretJSON generates the credentials of the system secret
+// as a JSON object instead of the INI config read by the cloud provider, for
+// the tools that template them. The object holds the same settings as
+// CloudProviderConfigSecret, under the same keys, and leaves out the unset
+// ones. Every value is a string, as it is in the config.
+func CloudProviderConfigSecretJSON(cloud *clientconfig.Cloud, opts ...Option) ([]byte, error) {
+	global, err := secretGlobal(cloud, newOptions(opts))
+	if err != nil {
+		return nil, err
 	}
-	if cloud.AuthInfo.ProjectName != "" {
-		res.WriteString("tenant-name = " + strconv.Quote(cloud.AuthInfo.ProjectName) + "\n")
+
+	settings := make(map[string]string, global.Len())
+	for _, setting := range global.settings {
+		settings[setting.key] = setting.value
 	}
-	if domainID != "" {
-		res.WriteString("domain-id = " + strconv.Quote(domainID) + "\n")
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, Error{err, "failed to encode cloud provider config secret"}
 	}
-	if domainName != "" {
-		res.WriteString("domain-name = " + strconv.Quote(domainName) + "\n")
+	return data, nil
+}
+
+// secretGlobal returns the settings of the Global section of the system secret
+// for the given cloud, whichever way they are encoded.
+func secretGlobal(cloud *clientconfig.Cloud, o *options) (*SectionBuilder, error) {
+	if !hasAuthSettings(cloud) {
+		return nil, Error{errors.New("no credentials found in the selected cloud"), "failed to generate cloud provider config secret"}
 	}
-	if cloud.RegionName != "" {
-		res.WriteString("region = " + strconv.Quote(cloud.RegionName) + "\n")
+	if err := validateAuthType(cloud); err != nil {
+		return nil, err
 	}
-	if cloud.CACertFile != "" {
-		res.WriteString("ca-file = /etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem\n")
+	if err := validateTokenFile(o.tokenFile); err != nil {
+		return nil, err
+	}
+	region, err := cloudRegion(cloud, o.region, o.strict)
+	if err != nil {
+		return nil, err
+	}
+	authURL, err := secretAuthURL(cloud, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var global SectionBuilder
+	writeSecretGlobal(&global, cloud, authURL, region, o)
+	return &global, nil
+}
+
+// CloudProviderConfigSecretMulti generates the cloud provider config stored in
+// the system secret for several clouds at once, so that the cluster can fail
+// over between them. Each cloud is written to a Global subsection named after
+// it, in name order, and the options apply to every cloud. WithRegion and
+// WithRegionValidation are rejected, as the region of each cloud comes from
+// clouds.yaml and there is no network client to check it against. Only the
+// cloud provider versions that support multiple clouds can read this config:
+// the others reject named Global subsections.
+func CloudProviderConfigSecretMulti(clouds map[string]*clientconfig.Cloud, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
+	if o.region != "" {
+		return nil, Error{errors.New("a single region can't be set for several clouds, set the region of each cloud in clouds.yaml instead"), "invalid region"}
+	}
+	if o.validateRegion {
+		return nil, Error{errors.New("the regions of several clouds can't be validated"), "invalid region"}
+	}
+
+	names := make([]string, 0, len(clouds))
+	for name := range clouds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs Errors
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		trimmed := strings.TrimSpace(name)
+		switch {
+		case trimmed == "":
+			errs = append(errs, fmt.Errorf("cloud name %q is empty", name))
+		case seen[trimmed]:
+			errs = append(errs, fmt.Errorf("cloud name %q is duplicated", trimmed))
+		case !hasAuthSettings(clouds[name]):
+			errs = append(errs, fmt.Errorf("cloud %q has no authentication settings", name))
+		}
+		seen[trimmed] = true
+	}
+	if len(errs) > 0 {
+		return nil, Error{errs, "invalid clouds"}
+	}
+	if err := validateTokenFile(o.tokenFile); err != nil {
+		return nil, err
+	}
+
+	authURLs := make(map[string]string, len(names))
+	for _, name := range names {
+		if err := validateAuthType(clouds[name]); err != nil {
+			errs = append(errs, fmt.Errorf("cloud %q: %w", name, err))
+			continue
+		}
+		authURL, err := secretAuthURL(clouds[name], o)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cloud %q: %w", name, err))
+		}
+		authURLs[name] = authURL
+	}
+	if len(errs) > 0 {
+		return nil, Error{errs, "invalid clouds"}
+	}
+
+	var res strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			res.WriteString("\n")
+		}
+		var global SectionBuilder
+		writeSecretGlobal(&global, clouds[name], authURLs[name], clouds[name].RegionName, o)
+		body, err := global.render()
+		if err != nil {
+			return nil, err
+		}
+		res.WriteString("[Global " + strconv.Quote(strings.TrimSpace(name)) + "]\n" + body)
 	}
 
 	return []byte(res.String()), nil
 }
 
-func generateCloudProviderConfig(networkClient *gophercloud.ServiceClient, cloudConfig *clientconfig.Cloud, installConfig types.InstallConfig) (cloudProviderConfigData, cloudProviderConfigCABundleData string, err error) {
-	cloudProviderConfigData = `[Global]
-secret-name = openstack-credentials
-secret-namespace = kube-system
-`
-	if regionName := cloudConfig.RegionName; regionName != "" {
-		cloudProviderConfigData += "region = " + regionName + "\n"
+// hasAuthSettings reports whether the given cloud holds any authentication
+// setting. Partial settings are left to the cloud provider to reject.
+func hasAuthSettings(cloud *clientconfig.Cloud) bool {
+	return cloud != nil && cloud.AuthInfo != nil && *cloud.AuthInfo != (clientconfig.AuthInfo{})
+}
+
+// secretAuthURL returns the auth URL of the given cloud as written to the
+// credentials of the cloud provider.
+func secretAuthURL(cloud *clientconfig.Cloud, o *options) (string, error) {
+	authURL, err := cloudAuthURL(cloud, o.strict)
+	if err != nil || !o.normalizeAuthURL {
+		return authURL, err
+	}
+	return normalizedAuthURL(authURL, cloud.IdentityAPIVersion), nil
+}
+
+// writeSecretGlobal writes the settings of the Global section of the system
+// secret for the given cloud, auth URL and region.
+func writeSecretGlobal(res *SectionBuilder, cloud *clientconfig.Cloud, authURL, region string, o *options) {
+	if authURL != "" {
+		res.SetQuoted("auth-url", authURL)
+	}
+	if o.tokenFile != "" {
+		// The token identifies the user on its own, and replaces whichever
+		// static secret the cloud holds.
+		res.SetQuoted("token-file", o.tokenFile)
+	} else if cloud.AuthInfo.ApplicationCredentialSecret != "" {
+		// Application credentials take precedence over the password: when both
+		// are present the CCM would reject the ambiguous configuration.
+		if cloud.AuthInfo.ApplicationCredentialID != "" {
+			res.SetQuoted("application-credential-id", cloud.AuthInfo.ApplicationCredentialID)
+		} else {
+			// An application credential referenced by name is only unique
+			// per user, so Keystone still needs the user to find it.
+			writeSecretUser(res, cloud.AuthInfo)
+		}
+		if cloud.AuthInfo.ApplicationCredentialName != "" {
+			res.SetQuoted("application-credential-name", cloud.AuthInfo.ApplicationCredentialName)
+		}
+		res.SetQuoted("application-credential-secret", cloud.AuthInfo.ApplicationCredentialSecret)
+	} else if cloud.AuthInfo.Token != "" {
+		// Keystone tokens expire, after an hour by default, and the cloud
+		// provider can't renew them: token authentication only suits
+		// short-lived bootstrap scenarios, the credentials have to be
+		// replaced before the token expires.
+		res.SetQuoted("token-id", cloud.AuthInfo.Token)
+	} else {
+		writeSecretUser(res, cloud.AuthInfo)
+		if cloud.AuthInfo.Password != "" {
+			res.SetQuoted("password", cloud.AuthInfo.Password)
+		}
+	}
+	if o.trustID != "" {
+		// A trust already defines the scope of the token, so it can't be
+		// combined with a project scope.
+		res.SetQuoted("trust-id", o.trustID)
+	} else {
+		projectIDKey, projectNameKey := "tenant-id", "tenant-name"
+		if o.ccmVersion == V2 || o.layout == ExternalCCM {
+			projectIDKey, projectNameKey = "project-id", "project-name"
+		}
+		if cloud.AuthInfo.ProjectID != "" {
+			res.SetQuoted(projectIDKey, cloud.AuthInfo.ProjectID)
+		}
+		// The ID alone identifies the project, see WithProjectIDPrecedence.
+		if cloud.AuthInfo.ProjectName != "" && (cloud.AuthInfo.ProjectID == "" || !o.preferProjectID) {
+			res.SetQuoted(projectNameKey, cloud.AuthInfo.ProjectName)
+		}
+	}
+	writeDomain(res, cloud.AuthInfo, o)
+	if region != "" {
+		res.SetQuoted("region", region)
+	}
+	if cloud.CACertFile != "" {
+		res.SetQuoted("ca-file", o.caFile)
+	}
+	if cloud.Verify != nil && !*cloud.Verify {
+		res.SetQuoted("tls-insecure", formatBool(true))
+	}
+}
+
+// validateTokenFile checks that the token file set by WithTokenFile, if any,
+// is an absolute path. The cloud provider resolves a relative path against its
+// working directory, which isn't where the token is mounted.
+func validateTokenFile(tokenFile string) error {
+	if tokenFile != "" && !path.IsAbs(tokenFile) {
+		return Error{errors.New("the path must be absolute"), "invalid token file " + tokenFile}
+	}
+	return nil
+}
+
+// writeSecretUser writes the user the credentials belong to. The user ID is
+// preferred over the username, which is only unique within a domain.
+func writeSecretUser(res *SectionBuilder, auth *clientconfig.AuthInfo) {
+	switch {
+	case auth.UserID != "":
+		res.SetQuoted("user-id", auth.UserID)
+	case auth.Username != "":
+		res.SetQuoted("username", auth.Username)
+	}
+}
+
+// quoteValue quotes a value of the cloud provider config so that gcfg reads it
+// back verbatim. Unlike strconv.Quote, it only uses the escape sequences gcfg
+// understands, and writes every other character as is: gcfg rejects the \x
+// and \u sequences strconv.Quote emits for non-printable characters.
+func quoteValue(value string) string {
+	var res strings.Builder
+	res.WriteByte('"')
+	for _, r := range value {
+		switch r {
+		case '\\':
+			res.WriteString(`\\`)
+		case '"':
+			res.WriteString(`\"`)
+		case '\n':
+			res.WriteString(`\n`)
+		case '\t':
+			res.WriteString(`\t`)
+		default:
+			res.WriteRune(r)
+		}
+	}
+	res.WriteByte('"')
+	return res.String()
+}
+
+// cloudRegion returns the region the cloud provider manages resources in: the
+// given override when set, the region of the cloud otherwise. In strict mode,
+// an empty region is an error for the clouds listing several regions.
+func cloudRegion(cloud *clientconfig.Cloud, override string, strict bool) (string, error) {
+	if override == "" {
+		if strict && cloud.RegionName == "" && len(cloud.Regions) > 1 {
+			names := make([]string, 0, len(cloud.Regions))
+			for _, region := range cloud.Regions {
+				names = append(names, region.Name)
+			}
+			return "", Error{fmt.Errorf("the cloud has several regions (%s) but none is selected", strings.Join(names, ", ")), "missing region"}
+		}
+		return cloud.RegionName, nil
+	}
+	if strings.TrimSpace(override) == "" {
+		return "", Error{errors.New("the region is blank"), "invalid region " + strconv.Quote(override)}
+	}
+	return override, nil
+}
+
+// writeDomain writes the Keystone domains the user and the project of the
+// credentials belong to. The V1 cloud provider only reads the generic
+// domain-id and domain-name keys, which fall back to the user domain when the
+// cloud doesn't set a domain. For the V2 cloud provider, the generic keys are
+// only written when the cloud doesn't set a user or a project domain;
+// otherwise the generic domain of the cloud only defaults the user-domain-*
+// and project-domain-* keys the cloud leaves unset, as it does in clouds.yaml.
+func writeDomain(res *SectionBuilder, auth *clientconfig.AuthInfo, o *options) {
+	if auth == nil {
+		return
+	}
+	if o.ccmVersion != V2 && o.layout != ExternalCCM {
+		domainID, domainName := auth.DomainID, auth.DomainName
+		if domainID == "" {
+			domainID = auth.UserDomainID
+		}
+		if domainName == "" {
+			domainName = auth.UserDomainName
+		}
+		if domainID != "" {
+			res.SetQuoted("domain-id", domainID)
+		}
+		if domainName != "" {
+			res.SetQuoted("domain-name", domainName)
+		}
+		return
+	}
+	writeDomainKeys(res, "id", auth.DomainID, auth.UserDomainID, auth.ProjectDomainID)
+	writeDomainKeys(res, "name", auth.DomainName, auth.UserDomainName, auth.ProjectDomainName)
+}
+
+// writeDomainKeys writes the V2 domain keys with the given suffix, either id
+// or name.
+func writeDomainKeys(res *SectionBuilder, suffix, domain, userDomain, projectDomain string) {
+	if userDomain == "" && projectDomain == "" {
+		if domain != "" {
+			res.SetQuoted("domain-"+suffix, domain)
+		}
+		return
+	}
+
+	if userDomain == "" {
+		userDomain = domain
+	}
+	if projectDomain == "" {
+		projectDomain = domain
+	}
+	if userDomain != "" {
+		res.SetQuoted("user-domain-"+suffix, userDomain)
+	}
+	if projectDomain != "" {
+		res.SetQuoted("project-domain-"+suffix, projectDomain)
+	}
+}
+
+func generateCloudProviderConfig(ctx context.Context, networkClient networkResolver, cloudConfig *clientconfig.Cloud, providerOpts CloudProviderOptions, opts ...Option) (cloudProviderConfigData, cloudProviderConfigCABundleData string, err error) {
+	cloudProviderConfigData, cloudProviderConfigCABundleData, _, err = generateCloudProviderConfigAndNetworkIDs(ctx, networkClient, cloudConfig, providerOpts, opts...)
+	return cloudProviderConfigData, cloudProviderConfigCABundleData, err
+}
+
+func generateCloudProviderConfigAndNetworkIDs(ctx context.Context, networkClient networkResolver, cloudConfig *clientconfig.Cloud, providerOpts CloudProviderOptions, opts ...Option) (cloudProviderConfigData, cloudProviderConfigCABundleData string, floatingNetworkIDs []string, err error) {
+	var res strings.Builder
+	cloudProviderConfigCABundleData, floatingNetworkIDs, err = writeCloudProviderConfig(ctx, &res, networkClient, cloudConfig, providerOpts, opts...)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return res.String(), cloudProviderConfigCABundleData, floatingNetworkIDs, nil
+}
+
+// writeCloudProviderConfig writes the cloud provider config to w, built
+// section by section. Nothing is written when the configuration is invalid.
+func writeCloudProviderConfig(ctx context.Context, w io.Writer, networkClient networkResolver, cloudConfig *clientconfig.Cloud, providerOpts CloudProviderOptions, opts ...Option) (cloudProviderConfigCABundleData string, floatingNetworkIDs []string, err error) {
+	o := newOptions(opts)
+
+	var caBundle string
+	if config := providerOpts.Config; config != nil && config.CABundle != "" {
+		decoded, err := decodeCABundle(config.CABundle)
+		if err != nil {
+			return "", nil, err
+		}
+		// The CA bundle of the install config stands for the ca-cert of
+		// clouds.yaml, which is never read.
+		cloud := *cloudConfig
+		cloud.CACertFile = o.caFile
+		cloudConfig, caBundle = &cloud, decoded
+	}
+
+	var identityAPIVersion string
+	if config := providerOpts.Config; config != nil && config.IdentityAPIVersion != "" {
+		switch config.IdentityAPIVersion {
+		case "2", "3":
+			identityAPIVersion = config.IdentityAPIVersion
+		default:
+			return "", nil, Error{fmt.Errorf("unsupported identity API version %q, must be 2 or 3", config.IdentityAPIVersion), "invalid identity-api-version"}
+		}
+		// The pinned version stands for the identity_api_version of
+		// clouds.yaml, so that the credentials are checked against it.
+		cloud := *cloudConfig
+		cloud.IdentityAPIVersion = identityAPIVersion
+		cloudConfig = &cloud
+	}
+
+	if err := validateAuthURL(cloudConfig); err != nil {
+		return "", nil, err
+	}
+	if err := validateIdentityAPIVersion(cloudConfig); err != nil {
+		return "", nil, err
+	}
+
+	var regionOverride string
+	if config := providerOpts.Config; config != nil {
+		regionOverride = config.Region
+	}
+	regionName, err := cloudRegion(cloudConfig, regionOverride, o.strict)
+	if err != nil {
+		return "", nil, err
+	}
+	if o.validateRegion && regionName != "" && networkClient != nil {
+		if err := validateRegion(ctx, networkClient, regionName, o); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if o.clusterAPI {
+		switch {
+		case o.inlineCredentials:
+			return "", nil, Error{errors.New("conflicts with the inline credentials"), "invalid Cluster API mode"}
+		case o.cloudsFile != "":
+			return "", nil, Error{errors.New("conflicts with the clouds file " + o.cloudsFile), "invalid Cluster API mode"}
+		}
+	}
+
+	builder := NewConfigBuilder().Header(o.header...)
+	global := builder.Global()
+	if o.inlineCredentials {
+		if o.cloudsFile != "" {
+			return "", nil, Error{errors.New("conflicts with the clouds file " + o.cloudsFile), "invalid inline credentials"}
+		}
+		if !hasAuthSettings(cloudConfig) {
+			return "", nil, Error{errors.New("no credentials found in the selected cloud"), "invalid inline credentials"}
+		}
+		if err := validateAuthType(cloudConfig); err != nil {
+			return "", nil, err
+		}
+		if err := validateTokenFile(o.tokenFile); err != nil {
+			return "", nil, err
+		}
+		authURL, err := secretAuthURL(cloudConfig, o)
+		if err != nil {
+			return "", nil, err
+		}
+		writeSecretGlobal(global, cloudConfig, authURL, regionName, o)
+	} else {
+		// Cluster API reads the credentials on its own, so the config only
+		// holds the settings that don't depend on them.
+		if !o.clusterAPI {
+			if o.cloudsFile != "" {
+				cloudName := o.cloudName
+				if cloudName == "" {
+					cloudName = providerOpts.Cloud
+				}
+				if strings.TrimSpace(cloudName) == "" {
+					return "", nil, Error{errors.New("a cloud name is required"), "invalid clouds file " + o.cloudsFile}
+				}
+				global.SetBool("use-clouds", true)
+				global.SetQuoted("clouds-file", o.cloudsFile)
+				global.SetQuoted("cloud", cloudName)
+			} else {
+				secretName, secretNamespace, err := credentialsSecret(providerOpts.Config, o.layout)
+				if err != nil {
+					return "", nil, err
+				}
+				global.Set("secret-name", secretName)
+				global.Set("secret-namespace", secretNamespace)
+			}
+			// The domain is written along with the secret reference so that both
+			// configs agree on the domain the credentials belong to.
+			writeDomain(global, cloudConfig.AuthInfo, o)
+		}
+		if regionName != "" {
+			global.SetQuoted("region", regionName)
+		}
+		if cloudConfig.CACertFile != "" && !o.inlineCABundle {
+			global.SetQuoted("ca-file", o.caFile)
+		}
+	}
+	if config := providerOpts.Config; config != nil && config.EndpointType != "" {
+		switch config.EndpointType {
+		case "public", "internal", "admin":
+			global.Set("os-endpoint-type", config.EndpointType)
+		default:
+			return "", nil, Error{fmt.Errorf("unsupported endpoint type %q, must be public, internal or admin", config.EndpointType), "invalid os-endpoint-type"}
+		}
+	}
+	if identityAPIVersion != "" {
+		global.Set("identity-api-version", identityAPIVersion)
+	}
+
+	networkName := strings.TrimSpace(providerOpts.ExternalNetwork) // Yes, we use a name in install-config.yaml :/
+	if networkName == "" && providerOpts.ExternalNetwork != "" {
+		return "", nil, Error{errors.New("the name is blank"), "invalid external network " + strconv.Quote(providerOpts.ExternalNetwork)}
+	}
+	var lbDisabled bool
+	if config := providerOpts.Config; config != nil && config.LoadBalancer != nil && config.LoadBalancer.Disabled {
+		if err := validateDisabledLoadBalancer(config.LoadBalancer); err != nil {
+			return "", nil, err
+		}
+		lbDisabled = true
+	}
+	if config := providerOpts.Config; config != nil && config.LoadBalancer != nil && config.LoadBalancer.InternalLB {
+		// Internal load balancers never get a floating IP, so the external
+		// network isn't resolved at all.
+		if networkName != "" {
+			return "", nil, Error{errors.New("conflicts with the external network " + networkName), "invalid internal-lb"}
+		}
+	}
+	var floatingNetworkID string
+	var additionalNetworks []string
+	if config := providerOpts.Config; config != nil && config.LoadBalancer != nil {
+		additionalNetworks = config.LoadBalancer.AdditionalExternalNetworks
+	}
+	var networkNames []string
+	switch {
+	case lbDisabled:
+		// The external network only provides the floating IPs of the load
+		// balancers, so it isn't resolved at all.
+		logrus.Debug("Load balancers disabled, leaving the floating network of the load balancers unset")
+	case networkName != "":
+		networkNames = append([]string{networkName}, additionalNetworks...)
+	default:
+		if len(additionalNetworks) > 0 {
+			return "", nil, Error{errors.New("an external network is required"), "invalid additional external networks"}
+		}
+		logrus.Debug("No external network configured, leaving the floating network of the load balancers unset")
+	}
+
+	// The CA bundle is read while the external networks are resolved, which
+	// can take a while on slow clouds. A failure of either cancels the other,
+	// whose error is then only the cancellation: the CA bundle error is
+	// reported first, as when both ran in turn.
+	group, groupCtx := errgroup.WithContext(ctx)
+	var caErr, networkErr error
+	if caCertFile := cloudConfig.CACertFile; caCertFile != "" && caBundle == "" && !o.skipCABundle {
+		group.Go(func() error {
+			cloudProviderConfigCABundleData, caErr = readCABundle(caCertFile, o)
+			return caErr
+		})
+	}
+	if len(networkNames) > 0 {
+		group.Go(func() error {
+			floatingNetworkIDs, networkErr = resolveFloatingNetworks(groupCtx, networkClient, networkNames, o)
+			return networkErr
+		})
+	}
+	if err := group.Wait(); err != nil {
+		if caErr != nil {
+			return "", nil, caErr
+		}
+		return "", nil, networkErr
+	}
+	if caBundle != "" {
+		cloudProviderConfigCABundleData = caBundle
+	}
+	if err := validateCABundleSize(cloudProviderConfigCABundleData, o); err != nil {
+		return "", nil, err
+	}
+	if len(floatingNetworkIDs) > 0 {
+		// The cloud provider only supports a single floating network, so the
+		// first one is used and the others are only returned to the caller.
+		floatingNetworkID = floatingNetworkIDs[0]
+	}
+
+	var floatingSubnetID string
+	if config := providerOpts.Config; config != nil && config.LoadBalancer != nil && (config.LoadBalancer.FloatingSubnet != "" || config.LoadBalancer.FloatingSubnetTag != "") {
+		subnetName, tag := config.LoadBalancer.FloatingSubnet, config.LoadBalancer.FloatingSubnetTag
+		if tag != "" {
+			if subnetName != "" {
+				return "", nil, Error{errors.New("conflicts with the floating subnet " + subnetName), "invalid floating subnet tag " + tag}
+			}
+			// The subnet is only known by its tag until it is found.
+			subnetName = "tagged " + tag
+		}
+		if floatingNetworkID == "" {
+			return "", nil, Error{errors.New("an external network is required"), "invalid floating subnet " + subnetName}
+		}
+		_, _, cidrErr := net.ParseCIDR(subnetName)
+		switch {
+		case tag != "":
+			floatingSubnetID, err = networkClient.SubnetIDFromTag(ctx, floatingNetworkID, tag)
+		case cidrErr == nil:
+			floatingSubnetID, err = networkClient.SubnetIDFromCIDR(ctx, floatingNetworkID, subnetName)
+		default:
+			floatingSubnetID, err = networkClient.SubnetIDFromName(ctx, floatingNetworkID, subnetName)
+		}
+		if err != nil {
+			return "", nil, Error{err, "failed to find floating subnet " + subnetName + " in external network " + networkName}
+		}
+
+		// The subnet lookups already filter on the external network, but the
+		// network of the subnet itself is checked as well, so that a subnet
+		// outside of the external network is never written whichever way it
+		// was found.
+		subnetNetworkID, err := networkClient.SubnetNetworkID(ctx, floatingSubnetID)
+		if err != nil {
+			return "", nil, Error{err, "failed to get floating subnet " + subnetName}
+		}
+		if subnetNetworkID != floatingNetworkID {
+			return "", nil, Error{fmt.Errorf("the subnet belongs to network %s, not to the external network %s (%s)", subnetNetworkID, networkName, floatingNetworkID), "invalid floating subnet " + subnetName}
+		}
+	}
+
+	var memberSubnetID string
+	if subnetName := providerOpts.MemberSubnet; subnetName != "" && !lbDisabled {
+		memberSubnetID, err = networkClient.SubnetIDFromName(ctx, providerOpts.MemberSubnetNetworkID, subnetName)
+		if err != nil {
+			return "", nil, Error{err, "failed to find member subnet " + subnetName}
+		}
+	}
+
+	var internalNetworkName string
+	if config := providerOpts.Config; config != nil && config.Networking != nil && config.Networking.InternalNetworkFromMachineSubnet && providerOpts.MachineSubnet != "" {
+		subnetName := providerOpts.MachineSubnet
+		subnetID, err := networkClient.SubnetIDFromName(ctx, providerOpts.MachineSubnetNetworkID, subnetName)
+		if err != nil {
+			return "", nil, Error{err, "failed to find machine subnet " + subnetName}
+		}
+		networkID, err := networkClient.SubnetNetworkID(ctx, subnetID)
+		if err != nil {
+			return "", nil, Error{err, "failed to get machine subnet " + subnetName}
+		}
+		internalNetworkName, err = networkClient.NetworkName(ctx, networkID)
+		if err != nil {
+			return "", nil, Error{err, "failed to get the network of machine subnet " + subnetName}
+		}
+	}
+
+	// The settings of the sections are validated together, so that all the
+	// invalid settings are reported at once.
+	var errs Errors
+	if err := networkingSection(builder.Networking(), providerOpts.Config, networkName, internalNetworkName); err != nil {
+		errs = append(errs, err)
+	}
+	lbOpts := LBOptions{FloatingNetworkID: floatingNetworkID, FloatingSubnetID: floatingSubnetID, SubnetID: memberSubnetID}
+	if config := providerOpts.Config; config != nil {
+		lbOpts.LoadBalancer = config.LoadBalancer
+	}
+	if !lbDisabled {
+		if err := loadBalancerSection(builder.LoadBalancer(), lbOpts); err != nil {
+			errs = append(errs, err)
+		}
+	} else if o.ccmVersion == V2 || o.layout == ExternalCCM {
+		// The V2 cloud provider manages the load balancers unless told
+		// otherwise, a missing section isn't enough to disable them.
+		builder.LoadBalancer().SetBool("enabled", false)
+	}
+	if err := blockStorageSection(builder.BlockStorage(), providerOpts.Config, providerOpts.RootVolumeZones, providerOpts.NodeVolumeAttachLimit); err != nil {
+		errs = append(errs, err)
+	}
+	if err := metadataSection(builder.Metadata(), providerOpts.Config); err != nil {
+		errs = append(errs, err)
+	}
+	switch len(errs) {
+	case 0:
+	case 1:
+		return "", nil, errs[0]
+	default:
+		return "", nil, errs
+	}
+
+	if config := providerOpts.Config; config != nil && config.Route != nil && config.Route.Router != "" {
+		routerName := config.Route.Router
+		routerID, err := networkClient.RouterIDFromName(ctx, routerName)
+		if err != nil {
+			return "", nil, Error{err, "failed to find router " + routerName}
+		}
+		builder.Route().Set("router-id", routerID)
+	} else {
+		logrus.Debug("No router configured, leaving the routes of the nodes to the network plugin")
+	}
+
+	if _, err := builder.WriteTo(w); err != nil {
+		return "", nil, err
+	}
+
+	return cloudProviderConfigCABundleData, floatingNetworkIDs, nil
+}
+
+// resolveFloatingNetworks returns the IDs of the external networks with the
+// given names or IDs, in order. The networks are looked up by name and by ID
+// rather than iterated over, so that the errors don't depend on the map
+// iteration order.
+func resolveFloatingNetworks(ctx context.Context, networkClient networkResolver, networkNames []string, o *options) ([]string, error) {
+	networkIDs := make([]string, 0, len(networkNames))
+	seen := make(map[string]bool, len(networkNames))
+	namesByID := make(map[string]string, len(networkNames))
+	for _, name := range networkNames {
+		if strings.TrimSpace(name) == "" {
+			return nil, Error{errors.New("the name is blank"), "invalid external network " + strconv.Quote(name)}
+		}
+		if seen[name] {
+			return nil, Error{errors.New("the network is listed twice"), "invalid external network " + name}
+		}
+		networkID, err := resolveExternalNetwork(ctx, networkClient, name, o)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := namesByID[networkID]; ok {
+			return nil, Error{fmt.Errorf("the network is the same as %s (%s)", other, networkID), "invalid external network " + name}
+		}
+		seen[name] = true
+		namesByID[networkID] = name
+		networkIDs = append(networkIDs, networkID)
 	}
+	return networkIDs, nil
+}
 
-	if caCertFile := cloudConfig.CACertFile; caCertFile != "" {
-		cloudProviderConfigData += "ca-file = /etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem\n"
-		caFile, err := os.ReadFile(caCertFile)
+// resolveExternalNetwork returns the ID of the external network with the given
+// name or ID, checking that it can provide floating IPs.
+func resolveExternalNetwork(ctx context.Context, networkClient networkResolver, networkName string, o *options) (string, error) {
+	// The external network is documented as a name, but an ID is often
+	// given instead, which the name lookup would never match.
+	isID := isUUID(networkName)
+	networkID := networkName
+	if !isID {
+		var err error
+		networkID, err = withRetries(ctx, o.lookupRetries, o.lookupRetryDelay, func() (string, error) {
+			return networkClient.IDFromName(ctx, networkName)
+		})
 		if err != nil {
-			return "", "", Error{err, "failed to read clouds.yaml ca-cert from disk"}
+			var notFound gophercloud.ErrResourceNotFound
+			var multipleFound gophercloud.ErrMultipleResourcesFound
+			switch {
+			case errors.As(err, &notFound):
+				return "", Error{ErrNetworkNotFound, "failed to find external network " + networkName}
+			case errors.As(err, &multipleFound):
+				return "", Error{fmt.Errorf("%w (%d matches)", ErrAmbiguousNetwork, multipleFound.Count), "external network name " + networkName + " is ambiguous"}
+			default:
+				return "", Error{err, "failed to fetch external network " + networkName}
+			}
+		}
+	}
+	// The lookup only matches the name, so make sure that the network can
+	// actually provide the floating IPs of the load balancers. This also
+	// checks that a network given by ID exists.
+	external, err := withRetries(ctx, o.lookupRetries, o.lookupRetryDelay, func() (bool, error) {
+		return networkClient.IsExternal(ctx, networkID)
+	})
+	if err != nil {
+		var notFound gophercloud.ErrDefault404
+		if isID && errors.As(err, &notFound) {
+			return "", Error{ErrNetworkNotFound, "failed to find external network with ID " + networkID}
+		}
+		return "", Error{err, "failed to fetch external network " + networkName}
+	}
+	if !external {
+		return "", Error{fmt.Errorf("network %s is not external (router:external is false)", networkID), "external network " + networkName + " is not usable for floating IPs"}
+	}
+	return networkID, nil
+}
+
+// validateRegion checks that the given region is one of the Keystone regions
+// of the cloud, which a typo in its name would otherwise only reveal once the
+// cloud provider fails to find its endpoints.
+func validateRegion(ctx context.Context, networkClient networkResolver, region string, o *options) error {
+	regionIDs, err := withRetries(ctx, o.lookupRetries, o.lookupRetryDelay, func() ([]string, error) {
+		return networkClient.RegionIDs(ctx)
+	})
+	if err != nil {
+		return Error{err, "failed to list the regions of the cloud"}
+	}
+	for _, id := range regionIDs {
+		if id == region {
+			return nil
+		}
+	}
+	sort.Strings(regionIDs)
+	return Error{fmt.Errorf("the cloud has no such region, available regions: %s", strings.Join(regionIDs, ", ")), "invalid region " + strconv.Quote(region)}
+}
+
+// isUUID reports whether the given value is a UUID in its canonical
+// hyphenated form, as used for the IDs of the Neutron resources.
+func isUUID(value string) bool {
+	_, err := uuid.Parse(value)
+	return err == nil && len(value) == 36
+}
+
+// CredentialsSecret returns the name and the namespace of the secret the cloud
+// provider config generated by GenerateCloudProviderConfig references, so that
+// the installer can create it when it isn't the default one.
+func CredentialsSecret(config *openstacktypes.CloudProviderConfig) (name, namespace string, err error) {
+	return credentialsSecret(config, InTree)
+}
+
+// credentialsSecret returns the name and the namespace of the secret the cloud
+// provider reads its credentials from, defaulting to the secret created by the
+// installer for the layout.
+func credentialsSecret(config *openstacktypes.CloudProviderConfig, layout Layout) (name, namespace string, err error) {
+	name, namespace = defaultSecretName, layout.secretNamespace()
+	if config == nil {
+		return name, namespace, nil
+	}
+
+	if config.SecretName != "" {
+		if msgs := validation.IsDNS1123Subdomain(config.SecretName); len(msgs) > 0 {
+			return "", "", Error{errors.New(strings.Join(msgs, "; ")), "invalid secret-name " + strconv.Quote(config.SecretName)}
+		}
+		name = config.SecretName
+	}
+	if config.SecretNamespace != "" {
+		if msgs := validation.IsDNS1123Label(config.SecretNamespace); len(msgs) > 0 {
+			return "", "", Error{errors.New(strings.Join(msgs, "; ")), "invalid secret-namespace " + strconv.Quote(config.SecretNamespace)}
 		}
-		cloudProviderConfigCABundleData = string(caFile)
+		namespace = config.SecretNamespace
 	}
+	return name, namespace, nil
+}
 
-	if installConfig.OpenStack.ExternalNetwork != "" {
-		networkName := installConfig.OpenStack.ExternalNetwork // Yes, we use a name in install-config.yaml :/
-		networkID, err := networkutils.IDFromName(networkClient, networkName)
+// readCABundle reads the CA bundle referenced by the ca-cert setting of
+// clouds.yaml and checks that it holds valid certificates.
+func readCABundle(caCertFile string, o *options) (string, error) {
+	caFile, err := readCACertFile(caCertFile, o)
+	if err != nil {
+		return "", err
+	}
+	if err := validateCABundle(caFile); err != nil {
+		return "", Error{err, "invalid clouds.yaml ca-cert " + caCertFile}
+	}
+	return string(caFile), nil
+}
+
+// validateCABundleSize checks the size of the CA bundle against the limit set
+// by WithMaxCABundleSize.
+func validateCABundleSize(caBundle string, o *options) error {
+	if size := len(caBundle); o.maxCABundle > 0 && size > o.maxCABundle {
+		return Error{fmt.Errorf("the bundle is %d bytes, over the limit of %d bytes", size, o.maxCABundle), "invalid CA bundle"}
+	}
+	return nil
+}
+
+// decodeCABundle decodes the base64-encoded CA bundle of the cloud provider
+// config and checks that it holds valid certificates.
+func decodeCABundle(data string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+	if err != nil {
+		return "", Error{err, "invalid CA bundle of the cloud provider config"}
+	}
+	if err := validateCABundle(decoded); err != nil {
+		return "", Error{err, "invalid CA bundle of the cloud provider config"}
+	}
+	return string(decoded), nil
+}
+
+// readCACertFile reads the CA bundle referenced by the ca-cert setting of
+// clouds.yaml, from the filesystem set by WithFS or from disk.
+func readCACertFile(caCertFile string, o *options) ([]byte, error) {
+	if o.fsys != nil {
+		name := caCertFile
+		if !path.IsAbs(name) && o.cloudsYAMLDir != "" {
+			name = path.Join(o.cloudsYAMLDir, name)
+		}
+		name = strings.TrimPrefix(path.Clean(name), "/")
+		caFile, err := fs.ReadFile(o.fsys, name)
 		if err != nil {
-			return "", "", Error{err, "failed to fetch external network " + networkName}
+			return nil, Error{err, "failed to read clouds.yaml ca-cert at " + name}
+		}
+		return caFile, nil
+	}
+
+	caCertPath, err := resolveCACertFile(caCertFile, o.cloudsYAMLDir)
+	if err != nil {
+		return nil, Error{err, "failed to read clouds.yaml ca-cert from disk at " + caCertPath}
+	}
+	caFile, err := os.ReadFile(caCertPath)
+	if err != nil {
+		return nil, Error{err, "failed to read clouds.yaml ca-cert from disk at " + caCertPath}
+	}
+	return caFile, nil
+}
+
+// validateCABundle checks that the given CA bundle holds at least one PEM
+// certificate, and that all its certificates can be parsed. The cloud provider
+// would otherwise only fail when it starts.
+func validateCABundle(data []byte) error {
+	var certs int
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return fmt.Errorf("certificate %d: %w", certs+1, err)
 		}
-		// If set get the ID and configure CCM to use that network for LB FIPs.
-		cloudProviderConfigData += "\n[LoadBalancer]\n"
-		cloudProviderConfigData += "floating-network-id = " + networkID + "\n"
+		certs++
 	}
+	if certs == 0 {
+		return errors.New("no PEM certificate found")
+	}
+	return nil
+}
 
-	return cloudProviderConfigData, cloudProviderConfigCABundleData, nil
+// resolveCACertFile returns the absolute path of the CA bundle referenced by
+// clouds.yaml, with symlinks resolved. Like the OpenStack SDK, it resolves a
+// relative path against the directory of clouds.yaml. The absolute path is
+// returned along with any error so that it can be reported.
+func resolveCACertFile(caCertFile, cloudsYAMLDir string) (string, error) {
+	path := caCertFile
+	if !filepath.IsAbs(path) && cloudsYAMLDir != "" {
+		path = filepath.Join(cloudsYAMLDir, path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return caCertFile, err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path, err
+	}
+	return resolved, nil
 }
 
-func getNetworkClient(session *openstack.Session) (*gophercloud.ServiceClient, error) {
-	return clientconfig.NewServiceClient("network", session.ClientOpts)
+// networkingSection sets the settings of the [Networking] section of the
+// cloud provider config, given the names of the external network of the
+// cluster and of the network of its machine subnet.
+func networkingSection(res *SectionBuilder, config *openstacktypes.CloudProviderConfig, externalNetwork, machineNetwork string) error {
+	if config == nil || config.Networking == nil {
+		return nil
+	}
+	networking := config.Networking
+
+	// The cloud provider reads multiple network names from repeated keys.
+	publicNetworkNames := networking.PublicNetworkNames
+	if networking.PublicNetworkFromExternalNetwork && externalNetwork != "" {
+		listed := false
+		for _, name := range publicNetworkNames {
+			if name == externalNetwork {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			publicNetworkNames = append([]string{externalNetwork}, publicNetworkNames...)
+		}
+	}
+	for _, name := range publicNetworkNames {
+		res.SetQuoted("public-network-name", name)
+	}
+	internalNetworkNames := networking.InternalNetworkNames
+	if networking.InternalNetworkFromMachineSubnet && machineNetwork != "" {
+		listed := false
+		for _, name := range internalNetworkNames {
+			if name == machineNetwork {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			internalNetworkNames = append([]string{machineNetwork}, internalNetworkNames...)
+		}
+	}
+	for _, name := range internalNetworkNames {
+		res.SetQuoted("internal-network-name", name)
+	}
+	if networking.IPv6SupportDisabled != nil {
+		res.SetBool("ipv6-support-disabled", *networking.IPv6SupportDisabled)
+	}
+	if networking.AddressSortOrder != "" {
+		cidrs := strings.Split(networking.AddressSortOrder, ",")
+		for i, cidr := range cidrs {
+			cidrs[i] = strings.TrimSpace(cidr)
+			if _, _, err := net.ParseCIDR(cidrs[i]); err != nil {
+				return Error{err, "invalid address-sort-order"}
+			}
+		}
+		res.SetQuoted("address-sort-order", strings.Join(cidrs, ","))
+	}
+
+	return nil
+}
+
+// LBOptions are the settings of the [LoadBalancer] section of the cloud
+// provider config.
+type LBOptions struct {
+	// FloatingNetworkID is the ID of the external network the floating IPs
+	// of the load balancers are allocated from.
+	FloatingNetworkID string
+
+	// FloatingSubnetID is the ID of the subnet of the floating network the
+	// floating IPs are allocated from.
+	FloatingSubnetID string
+
+	// SubnetID is the ID of the subnet of the nodes the members of the load
+	// balancers are placed in.
+	SubnetID string
+
+	// LoadBalancer holds the other settings of the section.
+	LoadBalancer *openstacktypes.CloudProviderLoadBalancer
+}
+
+// RenderLoadBalancerSection renders the [LoadBalancer] section of the cloud
+// provider config, header included, as the generated config holds it. The IDs
+// are written as is, without any Neutron lookup. It returns an empty string
+// when no load balancer setting is configured.
+func RenderLoadBalancerSection(opts LBOptions) (string, error) {
+	builder := NewConfigBuilder()
+	if err := loadBalancerSection(builder.LoadBalancer(), opts); err != nil {
+		return "", err
+	}
+	data, err := builder.Build()
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// loadBalancerSection sets the settings of the [LoadBalancer] section of the
+// cloud provider config.
+func loadBalancerSection(res *SectionBuilder, opts LBOptions) error {
+	if opts.FloatingNetworkID != "" {
+		res.Set("floating-network-id", opts.FloatingNetworkID)
+	}
+	if opts.FloatingSubnetID != "" {
+		res.Set("floating-subnet-id", opts.FloatingSubnetID)
+	}
+	if opts.SubnetID != "" {
+		res.Set("subnet-id", opts.SubnetID)
+	}
+
+	if loadBalancer := opts.LoadBalancer; loadBalancer != nil {
+		if loadBalancer.InternalLB {
+			res.SetBool("internal-lb", true)
+		}
+
+		if useOctavia := loadBalancer.UseOctavia; useOctavia != nil {
+			if !*useOctavia && loadBalancer.Provider != "" {
+				return Error{fmt.Errorf("lb-provider %s requires Octavia", loadBalancer.Provider), "invalid use-octavia"}
+			}
+			res.SetBool("use-octavia", *useOctavia)
+		}
+
+		switch loadBalancer.Provider {
+		case "":
+		case "amphora", "ovn":
+			res.Set("lb-provider", loadBalancer.Provider)
+		default:
+			return Error{fmt.Errorf("unsupported provider %q, must be amphora or ovn", loadBalancer.Provider), "invalid lb-provider"}
+		}
+
+		switch loadBalancer.Method {
+		case "":
+		case "ROUND_ROBIN", "LEAST_CONNECTIONS", "SOURCE_IP":
+			res.Set("lb-method", loadBalancer.Method)
+		default:
+			return Error{fmt.Errorf("unsupported method %q, must be ROUND_ROBIN, LEAST_CONNECTIONS or SOURCE_IP", loadBalancer.Method), "invalid lb-method"}
+		}
+
+		if manage := loadBalancer.ManageSecurityGroups; manage != nil {
+			if *manage {
+				if opts.FloatingNetworkID == "" {
+					return Error{errors.New("an external network is required"), "invalid manage-security-groups"}
+				}
+				if loadBalancer.Provider == "ovn" {
+					return Error{errors.New("not supported by the ovn provider"), "invalid manage-security-groups"}
+				}
+			}
+			res.SetBool("manage-security-groups", *manage)
+		}
+
+		if loadBalancer.EnableIngressHostname {
+			res.SetBool("enable-ingress-hostname", true)
+		}
+		if suffix := loadBalancer.IngressHostnameSuffix; suffix != "" {
+			if !loadBalancer.EnableIngressHostname {
+				return Error{errors.New("requires enable-ingress-hostname"), "invalid ingress-hostname-suffix"}
+			}
+			if msgs := validation.IsDNS1123Subdomain(suffix); len(msgs) > 0 {
+				return Error{errors.New(strings.Join(msgs, "; ")), "invalid ingress-hostname-suffix " + strconv.Quote(suffix)}
+			}
+			res.Set("ingress-hostname-suffix", suffix)
+		}
+
+		if maxShared := loadBalancer.MaxSharedLB; maxShared != nil {
+			if *maxShared < 1 {
+				return Error{fmt.Errorf("%d is not a positive integer", *maxShared), "invalid max-shared-lb"}
+			}
+			res.SetInt("max-shared-lb", *maxShared)
+		}
+
+		if loadBalancer.CreateMonitor != nil {
+			res.SetBool("create-monitor", *loadBalancer.CreateMonitor)
+		}
+		if loadBalancer.MonitorDelay != "" {
+			if _, err := time.ParseDuration(loadBalancer.MonitorDelay); err != nil {
+				return Error{err, "invalid monitor-delay"}
+			}
+			res.Set("monitor-delay", loadBalancer.MonitorDelay)
+		}
+		if loadBalancer.MonitorTimeout != "" {
+			if _, err := time.ParseDuration(loadBalancer.MonitorTimeout); err != nil {
+				return Error{err, "invalid monitor-timeout"}
+			}
+			res.Set("monitor-timeout", loadBalancer.MonitorTimeout)
+		}
+		if retries := loadBalancer.MonitorMaxRetries; retries != nil {
+			if *retries <= 0 {
+				return Error{fmt.Errorf("%d is not a positive integer", *retries), "invalid monitor-max-retries"}
+			}
+			res.SetInt("monitor-max-retries", *retries)
+		}
+	}
+
+	return nil
+}
+
+// validateDisabledLoadBalancer checks that no other load balancer setting is
+// set along with Disabled, since none of them would have any effect.
+func validateDisabledLoadBalancer(loadBalancer *openstacktypes.CloudProviderLoadBalancer) error {
+	var conflicts []string
+	for _, setting := range []struct {
+		name string
+		set  bool
+	}{
+		{"use-octavia", loadBalancer.UseOctavia != nil},
+		{"lb-provider", loadBalancer.Provider != ""},
+		{"lb-method", loadBalancer.Method != ""},
+		{"internal-lb", loadBalancer.InternalLB},
+		{"additional external networks", len(loadBalancer.AdditionalExternalNetworks) > 0},
+		{"floating subnet", loadBalancer.FloatingSubnet != ""},
+		{"floating subnet tag", loadBalancer.FloatingSubnetTag != ""},
+		{"member subnet", loadBalancer.MemberSubnet != ""},
+		{"manage-security-groups", loadBalancer.ManageSecurityGroups != nil},
+		{"enable-ingress-hostname", loadBalancer.EnableIngressHostname},
+		{"ingress-hostname-suffix", loadBalancer.IngressHostnameSuffix != ""},
+		{"max-shared-lb", loadBalancer.MaxSharedLB != nil},
+		{"create-monitor", loadBalancer.CreateMonitor != nil},
+		{"monitor-delay", loadBalancer.MonitorDelay != ""},
+		{"monitor-timeout", loadBalancer.MonitorTimeout != ""},
+		{"monitor-max-retries", loadBalancer.MonitorMaxRetries != nil},
+	} {
+		if setting.set {
+			conflicts = append(conflicts, setting.name)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return Error{fmt.Errorf("conflicts with %s", strings.Join(conflicts, ", ")), "invalid disabled load balancers"}
+	}
+	return nil
+}
+
+// memberSubnet returns the name or ID of the subnet the members of the load
+// balancers are placed in, and the ID of its network when known. It defaults
+// to the machines subnet of the install config, and is empty when neither is
+// set.
+func memberSubnet(platform *openstacktypes.Platform) (subnet, networkID string) {
+	if config := platform.CloudProviderConfig; config != nil && config.LoadBalancer != nil && config.LoadBalancer.MemberSubnet != "" {
+		return config.LoadBalancer.MemberSubnet, ""
+	}
+	return machineSubnet(platform)
+}
+
+// machineSubnet returns the name or ID of the subnet of the machines, the one
+// of the control plane port or the machines subnet, and the ID of its network
+// when known. It is empty when neither is set.
+func machineSubnet(platform *openstacktypes.Platform) (subnet, networkID string) {
+	if port := platform.ControlPlanePort; port != nil && len(port.FixedIPs) > 0 {
+		// Dual-stack clusters have a second subnet on the same network, only
+		// the first one is used.
+		subnet := port.FixedIPs[0].Subnet
+		if subnet.ID != "" {
+			return subnet.ID, port.Network.ID
+		}
+		return subnet.Name, port.Network.ID
+	}
+	return platform.DeprecatedMachinesSubnet, ""
+}
+
+// blockStorageSection sets the settings of the [BlockStorage] section of the
+// cloud provider config, given the Cinder availability zones the root volumes
+// of the machines are created in and the volume attach limit of the default
+// machine platform.
+func blockStorageSection(res *SectionBuilder, config *openstacktypes.CloudProviderConfig, volumeZones []string, poolLimit *int) error {
+	var blockStorage openstacktypes.CloudProviderBlockStorage
+	if config != nil && config.BlockStorage != nil {
+		blockStorage = *config.BlockStorage
+	}
+
+	switch blockStorage.BSVersion {
+	case "":
+	case "v2", "v3", "auto":
+		res.Set("bs-version", blockStorage.BSVersion)
+	default:
+		return Error{fmt.Errorf("unsupported Cinder API version %q, must be v2, v3 or auto", blockStorage.BSVersion), "invalid bs-version"}
+	}
+	if blockStorage.IgnoreVolumeAZ {
+		// Ignoring the availability zones of the volumes is meant for clouds
+		// where Cinder has none, which pinning the root volumes to Cinder
+		// availability zones contradicts.
+		if len(volumeZones) > 0 {
+			return Error{errors.New("conflicts with the root volume availability zones " + strings.Join(volumeZones, ", ")), "invalid ignore-volume-az"}
+		}
+		res.SetBool("ignore-volume-az", true)
+	}
+	if blockStorage.AvailabilityZone != "" {
+		switch {
+		case strings.TrimSpace(blockStorage.AvailabilityZone) == "":
+			return Error{errors.New("the availability zone is blank"), "invalid availability-zone " + strconv.Quote(blockStorage.AvailabilityZone)}
+		case blockStorage.IgnoreVolumeAZ:
+			// The cloud provider can't both pin the volumes to a zone and
+			// ignore their zones when attaching them.
+			return Error{errors.New("conflicts with ignore-volume-az"), "invalid availability-zone"}
+		}
+		res.SetQuoted("availability-zone", blockStorage.AvailabilityZone)
+	}
+	if blockStorage.TrustDevicePath {
+		res.SetBool("trust-device-path", true)
+	}
+	limit, err := nodeVolumeAttachLimit(blockStorage.NodeVolumeAttachLimit, poolLimit)
+	if err != nil {
+		return err
+	}
+	if limit != nil {
+		res.SetInt("node-volume-attach-limit", *limit)
+	}
+
+	return nil
+}
+
+// nodeVolumeAttachLimit returns the node-volume-attach-limit of the cluster,
+// set either in the cloud provider config or on the default machine platform.
+// The cloud provider applies it to every node, so it can't be set per machine
+// pool.
+func nodeVolumeAttachLimit(configLimit, poolLimit *int) (*int, error) {
+	limit := configLimit
+	if poolLimit != nil {
+		if limit != nil && *limit != *poolLimit {
+			return nil, Error{fmt.Errorf("%d conflicts with the limit %d of the default machine platform", *limit, *poolLimit), "invalid node-volume-attach-limit"}
+		}
+		limit = poolLimit
+	}
+	if limit != nil && (*limit < minNodeVolumeAttachLimit || *limit > maxNodeVolumeAttachLimit) {
+		return nil, Error{fmt.Errorf("%d is not between %d and %d", *limit, minNodeVolumeAttachLimit, maxNodeVolumeAttachLimit), "invalid node-volume-attach-limit"}
+	}
+	return limit, nil
+}
+
+// rootVolumeZones returns the Cinder availability zones the root volumes of the
+// machines of the given install config are created in, in order and without
+// duplicates.
+func rootVolumeZones(installConfig types.InstallConfig) []string {
+	pools := []*openstacktypes.MachinePool{installConfig.OpenStack.DefaultMachinePlatform}
+	if installConfig.ControlPlane != nil {
+		pools = append(pools, installConfig.ControlPlane.Platform.OpenStack)
+	}
+	for _, compute := range installConfig.Compute {
+		pools = append(pools, compute.Platform.OpenStack)
+	}
+
+	var zones []string
+	seen := make(map[string]bool)
+	for _, pool := range pools {
+		if pool == nil || pool.RootVolume == nil {
+			continue
+		}
+		for _, zone := range pool.RootVolume.Zones {
+			if zone != "" && !seen[zone] {
+				seen[zone] = true
+				zones = append(zones, zone)
+			}
+		}
+	}
+	return zones
+}
+
+// metadataSection sets the settings of the [Metadata] section of the cloud
+// provider config.
+func metadataSection(res *SectionBuilder, config *openstacktypes.CloudProviderConfig) error {
+	if config == nil || config.Metadata == nil {
+		return nil
+	}
+	metadata := config.Metadata
+
+	if metadata.SearchOrder != "" {
+		sources := strings.Split(metadata.SearchOrder, ",")
+		for i, source := range sources {
+			sources[i] = strings.TrimSpace(source)
+			switch sources[i] {
+			case "configDrive", "metadataService":
+			default:
+				return Error{fmt.Errorf("unknown metadata source %q, must be configDrive or metadataService", sources[i]), "invalid search-order"}
+			}
+		}
+		res.Set("search-order", strings.Join(sources, ","))
+	}
+	if metadata.RequestTimeout != "" {
+		timeout, err := time.ParseDuration(metadata.RequestTimeout)
+		if err != nil {
+			return Error{err, "invalid request-timeout"}
+		}
+		if timeout <= 0 {
+			return Error{fmt.Errorf("%s is not a positive duration", metadata.RequestTimeout), "invalid request-timeout"}
+		}
+		// The cloud provider expects the timeout in seconds.
+		res.Set("request-timeout", strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)+"s")
+	}
+
+	return nil
+}
+
+// getNetworkClient returns a network client for the given session, sending
+// its requests to the given endpoint when set, to the endpoint of the service
+// catalog otherwise.
+func getNetworkClient(session *openstack.Session, endpoint string) (*gophercloud.ServiceClient, error) {
+	client, err := clientconfig.NewServiceClient("network", session.ClientOpts)
+	if err != nil {
+		return nil, err
+	}
+	setNetworkEndpoint(client, endpoint)
+	return client, nil
+}
+
+// setNetworkEndpoint points the given network client to the given endpoint,
+// as validated by networkEndpoint. The client is left untouched when the
+// endpoint is empty.
+func setNetworkEndpoint(client *gophercloud.ServiceClient, endpoint string) {
+	if endpoint == "" {
+		return
+	}
+	client.Endpoint = endpoint
+	// Like the clients built from the service catalog, the resources are
+	// under the version of the API.
+	client.ResourceBase = endpoint + "v2.0/"
+}
+
+// networkEndpoint checks that the given Neutron endpoint override is an
+// absolute HTTP or HTTPS URL, and returns it with the trailing slash
+// gophercloud expects. It returns an empty string when there is no override.
+func networkEndpoint(endpoint string) (string, error) {
+	if endpoint == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", Error{err, "invalid network endpoint"}
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", Error{errors.New("an absolute http or https URL is required"), "invalid network endpoint " + endpoint}
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+	return endpoint, nil
 }
 
 // GenerateCloudProviderConfig adds the cloud provider config for the OpenStack
 // platform in the provided configmap.
-func GenerateCloudProviderConfig(installConfig types.InstallConfig) (cloudProviderConfigData, cloudProviderConfigCABundleData string, err error) {
-	cloud, err := openstack.GetSession(installConfig.Platform.OpenStack.Cloud)
+func GenerateCloudProviderConfig(ctx context.Context, installConfig types.InstallConfig, opts ...Option) (cloudProviderConfigData, cloudProviderConfigCABundleData string, err error) {
+	session, err := openstack.GetSession(installConfig.Platform.OpenStack.Cloud)
 	if err != nil {
 		return "", "", Error{err, "failed to get cloud config for openstack"}
 	}
 
-	networkClient, err := getNetworkClient(cloud)
+	return GenerateCloudProviderConfigFromSession(ctx, session, installConfig, withCloudsYAMLDir(opts)...)
+}
+
+// GenerateCloudProviderConfigFromSession is like GenerateCloudProviderConfig,
+// but uses the given session instead of loading a new one from clouds.yaml.
+// The local clouds.yaml file isn't looked up either: a relative ca-cert path
+// of the session is resolved against the directory set by WithCloudsYAMLDir,
+// and WithFS serves the CA bundle from memory.
+func GenerateCloudProviderConfigFromSession(ctx context.Context, session *openstack.Session, installConfig types.InstallConfig, opts ...Option) (cloudProviderConfigData, cloudProviderConfigCABundleData string, err error) {
+	cloudProviderConfigData, cloudProviderConfigCABundleData, _, err = GenerateCloudProviderConfigAndNetworkIDsFromSession(ctx, session, installConfig, opts...)
+	return cloudProviderConfigData, cloudProviderConfigCABundleData, err
+}
+
+// GenerateCloudProviderConfigAndNetworkIDsFromSession is like
+// GenerateCloudProviderConfigFromSession, but also returns the IDs the external
+// networks resolved to, starting with the floating network of the config, or
+// nothing when there is no external network, so that the other manifests don't
+// have to query Neutron again.
+func GenerateCloudProviderConfigAndNetworkIDsFromSession(ctx context.Context, session *openstack.Session, installConfig types.InstallConfig, opts ...Option) (cloudProviderConfigData, cloudProviderConfigCABundleData string, floatingNetworkIDs []string, err error) {
+	var res strings.Builder
+	cloudProviderConfigCABundleData, floatingNetworkIDs, err = writeCloudProviderConfigFromSession(ctx, &res, session, installConfig, opts...)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return res.String(), cloudProviderConfigCABundleData, floatingNetworkIDs, nil
+}
+
+// WriteCloudProviderConfig writes the cloud provider config for the OpenStack
+// platform to w and returns the CA bundle the config refers to, if any. The
+// sections are written to w one by one as they are rendered, rather than held
+// in memory. The config is the one GenerateCloudProviderConfig returns.
+func WriteCloudProviderConfig(ctx context.Context, w io.Writer, installConfig types.InstallConfig, opts ...Option) (cloudProviderConfigCABundleData string, err error) {
+	session, err := openstack.GetSession(installConfig.Platform.OpenStack.Cloud)
+	if err != nil {
+		return "", Error{err, "failed to get cloud config for openstack"}
+	}
+
+	cloudProviderConfigCABundleData, _, err = writeCloudProviderConfigFromSession(ctx, w, session, installConfig, withCloudsYAMLDir(opts)...)
+	return cloudProviderConfigCABundleData, err
+}
+
+func writeCloudProviderConfigFromSession(ctx context.Context, w io.Writer, session *openstack.Session, installConfig types.InstallConfig, opts ...Option) (cloudProviderConfigCABundleData string, floatingNetworkIDs []string, err error) {
+	if err := ValidateCloud(session.CloudConfig); err != nil {
+		return "", nil, err
+	}
+	endpoint, err := networkEndpoint(newOptions(opts).networkEndpoint)
 	if err != nil {
-		return "", "", Error{err, "failed to create a network client"}
+		return "", nil, err
 	}
 
-	return generateCloudProviderConfig(networkClient, cloud.CloudConfig, installConfig)
+	// The authentication done while creating the client can't be cancelled,
+	// so at least don't start it for a context that is already done.
+	if err := ctx.Err(); err != nil {
+		return "", nil, Error{err, "failed to create a network client"}
+	}
+	networkClient, err := getNetworkClient(session, endpoint)
+	if err != nil {
+		return "", nil, Error{err, "failed to create a network client"}
+	}
+
+	return writeCloudProviderConfig(ctx, w, newNeutronResolver(networkClient, session.CloudConfig), session.CloudConfig, NewCloudProviderOptions(installConfig), opts...)
+}
+
+// withCloudsYAMLDir prepends the directory of the local clouds.yaml file to the
+// given options, so that options given by the caller take precedence over the
+// location of the clouds.yaml file the session was loaded from. It is only
+// meant for the functions that load the session themselves.
+func withCloudsYAMLDir(opts []Option) []Option {
+	if cloudsYAMLPath, _, err := clientconfig.FindAndReadCloudsYAML(); err == nil {
+		return append([]Option{WithCloudsYAMLDir(filepath.Dir(cloudsYAMLPath))}, opts...)
+	}
+	return opts
 }
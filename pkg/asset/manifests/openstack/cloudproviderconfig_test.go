@@ -1,15 +1,63 @@
 package openstack
 
 import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sirupsen/logrus"
+	logrusTest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/gcfg.v1"
+	"k8s.io/utils/pointer"
 
+	installconfigopenstack "github.com/openshift/installer/pkg/asset/installconfig/openstack"
 	"github.com/openshift/installer/pkg/types"
 	"github.com/openshift/installer/pkg/types/openstack"
 )
 
+// testCACert and testCABundle are a valid CA certificate and a valid bundle of
+// two CA certificates, in PEM format.
+var (
+	//go:embed testdata/ca.pem
+	testCACert string
+
+	//go:embed testdata/ca-bundle.pem
+	testCABundle string
+)
+
+func TestErrors(t *testing.T) {
+	err := Error{
+		Errors{
+			Error{ErrNetworkNotFound, "failed to find external network external"},
+			Error{errors.New("0 is not a positive integer"), "invalid monitor-max-retries"},
+		},
+		"invalid cloud provider config",
+	}
+
+	assert.EqualError(t, err, `invalid cloud provider config: failed to find external network external: no network found
+invalid monitor-max-retries: 0 is not a positive integer`)
+	assert.ErrorIs(t, err, ErrNetworkNotFound)
+
+	var errs Errors
+	if assert.ErrorAs(t, err, &errs) {
+		assert.Len(t, errs, 2)
+	}
+}
+
 func TestCloudProviderConfigSecret(t *testing.T) {
 	cloud := clientconfig.Cloud{
 		AuthInfo: &clientconfig.AuthInfo{
@@ -24,7 +72,7 @@ func TestCloudProviderConfigSecret(t *testing.T) {
 	}
 
 	expectedConfig := `[Global]
-auth-url = "https://my_auth_url.com/v3/"
+auth-url = "https://my_auth_url.com/v3"
 username = "my_user"
 password = "my_secret_password"
 tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
@@ -37,6 +85,93 @@ region = "my_region"
 	assert.Equal(t, expectedConfig, string(actualConfig), "unexpected cloud provider config")
 }
 
+func TestWriteCloudProviderConfigSecret(t *testing.T) {
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:    "https://my_auth_url.com/v3/",
+			Username:   "my_user",
+			Password:   "my_secret_password",
+			ProjectID:  "my_project_id",
+			DomainName: "Default",
+		},
+		RegionName: "my_region",
+		CACertFile: "/etc/openstack/ca.pem",
+	}
+
+	expectedConfig, err := CloudProviderConfigSecret(&cloud, WithTrustID("my_trust"))
+	assert.NoError(t, err, "failed to create cloud provider config")
+
+	var actualConfig bytes.Buffer
+	err = WriteCloudProviderConfigSecret(&actualConfig, &cloud, WithTrustID("my_trust"))
+	assert.NoError(t, err, "failed to write cloud provider config")
+	assert.Equal(t, expectedConfig, actualConfig.Bytes(), "unexpected cloud provider config")
+}
+
+func TestCloudProviderConfigSecretJSON(t *testing.T) {
+	cases := []struct {
+		name          string
+		cloud         clientconfig.Cloud
+		expectedJSON  string
+		expectedError string
+	}{
+		{
+			name: "password",
+			cloud: clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{
+					AuthURL:    "https://my_auth_url.com/v3/",
+					Username:   "my_user",
+					Password:   `my "secret" password#1`,
+					ProjectID:  "f12f928576ae4d21bdb984da5dd1d3bf",
+					DomainName: "Default",
+				},
+				RegionName: "my_region",
+			},
+			expectedJSON: `{
+				"auth-url": "https://my_auth_url.com/v3",
+				"username": "my_user",
+				"password": "my \"secret\" password#1",
+				"tenant-id": "f12f928576ae4d21bdb984da5dd1d3bf",
+				"domain-name": "Default",
+				"region": "my_region"
+			}`,
+		},
+		{
+			name: "application credential",
+			cloud: clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{
+					AuthURL:                     "https://my_auth_url.com/v3/",
+					ApplicationCredentialID:     "my_app_cred_id",
+					ApplicationCredentialSecret: "my_app_cred_secret",
+				},
+			},
+			expectedJSON: `{
+				"auth-url": "https://my_auth_url.com/v3",
+				"application-credential-id": "my_app_cred_id",
+				"application-credential-secret": "my_app_cred_secret"
+			}`,
+		},
+		{
+			name: "no credentials",
+			cloud: clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{},
+			},
+			expectedError: "failed to generate cloud provider config secret: no credentials found in the selected cloud",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actualJSON, err := CloudProviderConfigSecretJSON(&tc.cloud)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.JSONEq(t, tc.expectedJSON, string(actualJSON), "unexpected cloud provider config")
+		})
+	}
+}
+
 func TestCloudProviderConfigSecretUserDomain(t *testing.T) {
 	cloud := clientconfig.Cloud{
 		AuthInfo: &clientconfig.AuthInfo{
@@ -51,7 +186,7 @@ func TestCloudProviderConfigSecretUserDomain(t *testing.T) {
 	}
 
 	expectedConfig := `[Global]
-auth-url = "https://my_auth_url.com/v3/"
+auth-url = "https://my_auth_url.com/v3"
 username = "my_user"
 password = "my_secret_password"
 tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
@@ -93,45 +228,3811 @@ password = "` + v + `"
 	}
 }
 
-func TestCloudProviderConfig(t *testing.T) {
+func TestCloudProviderConfigSecretAuthTypes(t *testing.T) {
 	cases := []struct {
 		name           string
-		installConfig  *types.InstallConfig
+		authInfo       *clientconfig.AuthInfo
 		expectedConfig string
 	}{
 		{
-			name: "default install config",
-			installConfig: &types.InstallConfig{
-				Networking: &types.Networking{},
-				Platform: types.Platform{
-					OpenStack: &openstack.Platform{},
-				},
+			name: "password",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3/",
+				Username: "my_user",
+				Password: "my_secret_password",
 			},
 			expectedConfig: `[Global]
-secret-name = openstack-credentials
-secret-namespace = kube-system
-region = my_region
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+`,
+		},
+		{
+			name: "application credential by id",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3/",
+				ApplicationCredentialID:     "my_app_cred_id",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+application-credential-id = "my_app_cred_id"
+application-credential-secret = "my_app_cred_secret"
+`,
+		},
+		{
+			name: "application credential by name",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3/",
+				Username:                    "my_user",
+				ApplicationCredentialName:   "my_app_cred",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+application-credential-name = "my_app_cred"
+application-credential-secret = "my_app_cred_secret"
+`,
+		},
+		{
+			name: "application credential preferred over password",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3/",
+				Username:                    "my_user",
+				Password:                    "my_secret_password",
+				ApplicationCredentialID:     "my_app_cred_id",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+application-credential-id = "my_app_cred_id"
+application-credential-secret = "my_app_cred_secret"
+`,
+		},
+		{
+			name: "password with user id",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3/",
+				UserID:   "my_user_id",
+				Password: "my_secret_password",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+user-id = "my_user_id"
+password = "my_secret_password"
+`,
+		},
+		{
+			name: "user id preferred over username",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3/",
+				UserID:   "my_user_id",
+				Username: "my_user",
+				Password: "my_secret_password",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+user-id = "my_user_id"
+password = "my_secret_password"
+`,
+		},
+		{
+			name: "application credential by name with user id",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3/",
+				UserID:                      "my_user_id",
+				ApplicationCredentialName:   "my_app_cred",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+user-id = "my_user_id"
+application-credential-name = "my_app_cred"
+application-credential-secret = "my_app_cred_secret"
+`,
+		},
+		{
+			name: "token",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:     "https://my_auth_url.com/v3/",
+				Username:    "my_user",
+				Token:       "my_token",
+				ProjectName: "my_project",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+token-id = "my_token"
+tenant-name = "my_project"
+`,
+		},
+		{
+			name: "no token",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:     "https://my_auth_url.com/v3/",
+				Username:    "my_user",
+				Password:    "my_secret_password",
+				ProjectName: "my_project",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+tenant-name = "my_project"
 `,
 		},
 	}
 
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{AuthInfo: tc.authInfo}
+			actualConfig, err := CloudProviderConfigSecret(&cloud)
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, tc.expectedConfig, string(actualConfig), "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigSecretTrust(t *testing.T) {
 	cloud := clientconfig.Cloud{
 		AuthInfo: &clientconfig.AuthInfo{
-			Username:   "my_user",
-			Password:   "my_secret_password",
-			AuthURL:    "https://my_auth_url.com/v3/",
-			ProjectID:  "f12f928576ae4d21bdb984da5dd1d3bf",
-			DomainID:   "default",
-			DomainName: "Default",
+			Username:    "my_trustee",
+			Password:    "my_secret_password",
+			AuthURL:     "https://my_auth_url.com/v3/",
+			ProjectName: "my_project",
 		},
 		RegionName: "my_region",
 	}
 
+	expectedConfig := `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_trustee"
+password = "my_secret_password"
+trust-id = "0f1e2d3c4b5a69788796a5b4c3d2e1f0"
+region = "my_region"
+`
+	actualConfig, err := CloudProviderConfigSecret(&cloud, WithTrustID("0f1e2d3c4b5a69788796a5b4c3d2e1f0"))
+	assert.NoError(t, err, "failed to create cloud provider config")
+	assert.Equal(t, expectedConfig, string(actualConfig), "unexpected cloud provider config")
+}
+
+func TestCloudProviderConfigSecretTokenFile(t *testing.T) {
+	cases := []struct {
+		name           string
+		auth           clientconfig.AuthInfo
+		tokenFile      string
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name: "inline password",
+			auth: clientconfig.AuthInfo{
+				AuthURL:   "https://my_auth_url.com/v3",
+				Username:  "my_user",
+				Password:  "my_secret_password",
+				ProjectID: "f12f928576ae4d21bdb984da5dd1d3bf",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+		},
+		{
+			name: "token file replacing the password",
+			auth: clientconfig.AuthInfo{
+				AuthURL:   "https://my_auth_url.com/v3",
+				Username:  "my_user",
+				Password:  "my_secret_password",
+				ProjectID: "f12f928576ae4d21bdb984da5dd1d3bf",
+			},
+			tokenFile: "/var/run/secrets/openstack/token",
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+token-file = "/var/run/secrets/openstack/token"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+		},
+		{
+			name: "token file replacing the application credential",
+			auth: clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3",
+				ApplicationCredentialID:     "my_app_cred_id",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+			tokenFile: "/var/run/secrets/openstack/token",
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+token-file = "/var/run/secrets/openstack/token"
+`,
+		},
+		{
+			name: "relative token file",
+			auth: clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3",
+				Username: "my_user",
+				Password: "my_secret_password",
+			},
+			tokenFile:     "secrets/token",
+			expectedError: "invalid token file secrets/token: the path must be absolute",
+		},
+	}
+
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			actualConfig, _, err := generateCloudProviderConfig(nil, &cloud, *tc.installConfig)
-			assert.NoError(t, err, "unexpected error when generating cloud provider config")
-			assert.Equal(t, tc.expectedConfig, actualConfig, "unexpected cloud provider config")
+			cloud := clientconfig.Cloud{AuthInfo: &tc.auth}
+			actualConfig, err := CloudProviderConfigSecret(&cloud, WithTokenFile(tc.tokenFile))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, string(actualConfig))
+		})
+	}
+}
+
+func TestCloudProviderConfigSecretEmptyCredentials(t *testing.T) {
+	cases := []struct {
+		name           string
+		authInfo       *clientconfig.AuthInfo
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name:          "no auth settings",
+			expectedError: "failed to generate cloud provider config secret: no credentials found in the selected cloud",
+		},
+		{
+			name:          "empty auth settings",
+			authInfo:      &clientconfig.AuthInfo{},
+			expectedError: "failed to generate cloud provider config secret: no credentials found in the selected cloud",
+		},
+		{
+			name:     "partial credentials",
+			authInfo: &clientconfig.AuthInfo{Username: "my_user"},
+			expectedConfig: `[Global]
+username = "my_user"
+region = "my_region"
+`,
+		},
+		{
+			name: "complete credentials",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3/",
+				Username: "my_user",
+				Password: "my_secret_password",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+region = "my_region"
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   tc.authInfo,
+				RegionName: "my_region",
+			}
+
+			actualConfig, err := CloudProviderConfigSecret(&cloud)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, tc.expectedConfig, string(actualConfig), "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigSecretFederation(t *testing.T) {
+	cases := []struct {
+		name           string
+		authType       clientconfig.AuthType
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name:     "password",
+			authType: clientconfig.AuthV3Password,
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+region = "my_region"
+`,
+		},
+		{
+			name:          "saml",
+			authType:      "v3samlpassword",
+			expectedError: "unsupported auth_type v3samlpassword: Keystone federation is not supported yet, use a password or an application credential instead",
+		},
+		{
+			name:          "oidc",
+			authType:      "V3OIDCPassword",
+			expectedError: "unsupported auth_type V3OIDCPassword: Keystone federation is not supported yet, use a password or an application credential instead",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthType: tc.authType,
+				AuthInfo: &clientconfig.AuthInfo{
+					Username: "my_user",
+					Password: "my_secret_password",
+					AuthURL:  "https://my_auth_url.com/v3/",
+				},
+				RegionName: "my_region",
+			}
+
+			actualConfig, err := CloudProviderConfigSecret(&cloud)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, tc.expectedConfig, string(actualConfig), "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigSecretCCMVersion(t *testing.T) {
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:     "https://my_auth_url.com/v3/",
+			ProjectID:   "f12f928576ae4d21bdb984da5dd1d3bf",
+			ProjectName: "my_project",
+		},
+	}
+
+	cases := []struct {
+		name           string
+		opts           []Option
+		expectedConfig string
+	}{
+		{
+			name: "default",
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+		},
+		{
+			name: "v1",
+			opts: []Option{WithCCMVersion(V1)},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+		},
+		{
+			name: "v2",
+			opts: []Option{WithCCMVersion(V2)},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+project-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actualConfig, err := CloudProviderConfigSecret(&cloud, tc.opts...)
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, tc.expectedConfig, string(actualConfig), "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigSecretProjectPrecedence(t *testing.T) {
+	cases := []struct {
+		name           string
+		projectID      string
+		projectName    string
+		opts           []Option
+		expectedConfig string
+	}{
+		{
+			name:      "id only",
+			projectID: "f12f928576ae4d21bdb984da5dd1d3bf",
+			expectedConfig: `[Global]
+username = "my_user"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+		},
+		{
+			name:        "name only",
+			projectName: "my_project",
+			expectedConfig: `[Global]
+username = "my_user"
+tenant-name = "my_project"
+`,
+		},
+		{
+			name:        "both",
+			projectID:   "f12f928576ae4d21bdb984da5dd1d3bf",
+			projectName: "my_project",
+			expectedConfig: `[Global]
+username = "my_user"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+		},
+		{
+			name:        "both with v2 keys",
+			projectID:   "f12f928576ae4d21bdb984da5dd1d3bf",
+			projectName: "my_project",
+			opts:        []Option{WithCCMVersion(V2)},
+			expectedConfig: `[Global]
+username = "my_user"
+project-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+		},
+		{
+			name:        "both without precedence",
+			projectID:   "f12f928576ae4d21bdb984da5dd1d3bf",
+			projectName: "my_project",
+			opts:        []Option{WithProjectIDPrecedence(false)},
+			expectedConfig: `[Global]
+username = "my_user"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+tenant-name = "my_project"
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{
+					Username:    "my_user",
+					ProjectID:   tc.projectID,
+					ProjectName: tc.projectName,
+				},
+			}
+
+			actualConfig, err := CloudProviderConfigSecret(&cloud, tc.opts...)
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, tc.expectedConfig, string(actualConfig), "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigLayout(t *testing.T) {
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:     "https://my_auth_url.com/v3/",
+			ProjectID:   "f12f928576ae4d21bdb984da5dd1d3bf",
+			ProjectName: "my_project",
+		},
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+
+	cases := []struct {
+		name           string
+		opts           []Option
+		expectedSecret string
+		expectedConfig string
+	}{
+		{
+			name: "default",
+			expectedSecret: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`,
+		},
+		{
+			name: "in-tree",
+			opts: []Option{WithLayout(InTree)},
+			expectedSecret: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`,
+		},
+		{
+			name: "external ccm",
+			opts: []Option{WithLayout(ExternalCCM)},
+			expectedSecret: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+project-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = openshift-cloud-controller-manager
+`,
+		},
+		{
+			name: "external ccm with v1 keys",
+			opts: []Option{WithLayout(ExternalCCM), WithCCMVersion(V1)},
+			expectedSecret: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+project-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+`,
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = openshift-cloud-controller-manager
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			secretConfig, err := CloudProviderConfigSecret(&cloud, tc.opts...)
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, tc.expectedSecret, string(secretConfig), "unexpected cloud provider config")
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), tc.opts...)
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, config, "unexpected cloud provider config")
+		})
+	}
+
+	t.Run("explicit namespace", func(t *testing.T) {
+		installConfig := types.InstallConfig{
+			Networking: &types.Networking{},
+			Platform: types.Platform{
+				OpenStack: &openstack.Platform{
+					CloudProviderConfig: &openstack.CloudProviderConfig{
+						SecretNamespace: "my-namespace",
+					},
+				},
+			},
+		}
+		config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), WithLayout(ExternalCCM))
+		assert.NoError(t, err, "unexpected error when generating cloud provider config")
+		assert.Contains(t, config, "secret-namespace = my-namespace\n")
+	})
+}
+
+func TestCloudProviderConfigSecretTLSInsecure(t *testing.T) {
+	verifyTrue, verifyFalse := true, false
+
+	cases := []struct {
+		name           string
+		verify         *bool
+		expectedConfig string
+	}{
+		{
+			name: "verify unset",
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+`,
+		},
+		{
+			name:   "verify true",
+			verify: &verifyTrue,
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+`,
+		},
+		{
+			name:   "verify false",
+			verify: &verifyFalse,
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+tls-insecure = "true"
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{
+					AuthURL: "https://my_auth_url.com/v3/",
+				},
+				Verify: tc.verify,
+			}
+			actualConfig, err := CloudProviderConfigSecret(&cloud)
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, tc.expectedConfig, string(actualConfig), "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigSecretMulti(t *testing.T) {
+	clouds := map[string]*clientconfig.Cloud{
+		"secondary": {
+			AuthInfo: &clientconfig.AuthInfo{
+				AuthURL:   "https://secondary.example.com/v3/",
+				Username:  "my_user",
+				Password:  "my_secret_password",
+				ProjectID: "2b1c2cb0d04b4e8a9f2f3c4d5e6f7a8b",
+			},
+			RegionName: "region_two",
+		},
+		"primary": {
+			AuthInfo: &clientconfig.AuthInfo{
+				AuthURL:   "https://primary.example.com/v3/",
+				Username:  "my_user",
+				Password:  "my_secret_password",
+				ProjectID: "f12f928576ae4d21bdb984da5dd1d3bf",
+			},
+			RegionName: "region_one",
+		},
+	}
+
+	expectedConfig := `[Global "primary"]
+auth-url = "https://primary.example.com/v3"
+username = "my_user"
+password = "my_secret_password"
+tenant-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+region = "region_one"
+
+[Global "secondary"]
+auth-url = "https://secondary.example.com/v3"
+username = "my_user"
+password = "my_secret_password"
+tenant-id = "2b1c2cb0d04b4e8a9f2f3c4d5e6f7a8b"
+region = "region_two"
+`
+
+	actualConfig, err := CloudProviderConfigSecretMulti(clouds)
+	assert.NoError(t, err, "failed to create cloud provider config")
+	assert.Equal(t, expectedConfig, string(actualConfig), "unexpected cloud provider config")
+}
+
+func TestCloudProviderConfigSecretMultiInvalidNames(t *testing.T) {
+	cloud := &clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{Username: "my_user", Password: "my_secret_password"}}
+	clouds := map[string]*clientconfig.Cloud{
+		"":         cloud,
+		"primary":  cloud,
+		"primary ": cloud,
+		"other":    nil,
+	}
+
+	_, err := CloudProviderConfigSecretMulti(clouds)
+	assert.EqualError(t, err, `invalid clouds: cloud name "" is empty
+cloud "other" has no authentication settings
+cloud name "primary" is duplicated`)
+}
+
+func TestCloudProviderConfigSecretMultiRegionOptions(t *testing.T) {
+	clouds := map[string]*clientconfig.Cloud{
+		"primary": {
+			AuthInfo:   &clientconfig.AuthInfo{Username: "my_user", Password: "my_secret_password"},
+			RegionName: "region_one",
+		},
+	}
+
+	cases := []struct {
+		name          string
+		opts          []Option
+		expectedError string
+	}{
+		{
+			name: "empty region",
+			opts: []Option{WithRegion(""), WithRegionValidation(false)},
+		},
+		{
+			name:          "region",
+			opts:          []Option{WithRegion("region_two")},
+			expectedError: "invalid region: a single region can't be set for several clouds, set the region of each cloud in clouds.yaml instead",
+		},
+		{
+			name:          "region validation",
+			opts:          []Option{WithRegionValidation(true)},
+			expectedError: "invalid region: the regions of several clouds can't be validated",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := CloudProviderConfigSecretMulti(clouds, tc.opts...)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, string(config), `region = "region_one"`)
+		})
+	}
+}
+
+func TestCloudProviderConfig(t *testing.T) {
+	cases := []struct {
+		name           string
+		installConfig  *types.InstallConfig
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name: "default install config",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+`,
+		},
+		{
+			name: "single network names",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Networking: &openstack.CloudProviderNetworking{
+								PublicNetworkNames:   []string{"public"},
+								InternalNetworkNames: []string{"private"},
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[Networking]
+public-network-name = "public"
+internal-network-name = "private"
+`,
+		},
+		{
+			name: "multiple network names",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Networking: &openstack.CloudProviderNetworking{
+								PublicNetworkNames:   []string{"public", "public-v6"},
+								InternalNetworkNames: []string{"private", "storage"},
+								IPv6SupportDisabled:  pointer.Bool(false),
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[Networking]
+public-network-name = "public"
+public-network-name = "public-v6"
+internal-network-name = "private"
+internal-network-name = "storage"
+ipv6-support-disabled = false
+`,
+		},
+		{
+			name: "ipv6 support disabled",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Networking: &openstack.CloudProviderNetworking{
+								IPv6SupportDisabled: pointer.Bool(true),
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[Networking]
+ipv6-support-disabled = true
+`,
+		},
+		{
+			name: "address sort order",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Networking: &openstack.CloudProviderNetworking{
+								AddressSortOrder: "192.168.0.0/16, fd00::/8",
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[Networking]
+address-sort-order = "192.168.0.0/16,fd00::/8"
+`,
+		},
+		{
+			name: "empty address sort order",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Networking: &openstack.CloudProviderNetworking{
+								AddressSortOrder: "",
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+`,
+		},
+		{
+			name: "malformed address sort order",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Networking: &openstack.CloudProviderNetworking{
+								AddressSortOrder: "192.168.0.0/16,10.0.0.1",
+							},
+						},
+					},
+				},
+			},
+			expectedError: "invalid address-sort-order: invalid CIDR address: 10.0.0.1",
+		},
+		{
+			name: "amphora load balancer provider",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{
+								Provider: "amphora",
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[LoadBalancer]
+lb-provider = amphora
+`,
+		},
+		{
+			name: "ovn load balancer provider",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{
+								Provider: "ovn",
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[LoadBalancer]
+lb-provider = ovn
+`,
+		},
+		{
+			name: "empty load balancer provider",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+`,
+		},
+		{
+			name: "invalid load balancer provider",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{
+								Provider: "octavia",
+							},
+						},
+					},
+				},
+			},
+			expectedError: `invalid lb-provider: unsupported provider "octavia", must be amphora or ovn`,
+		},
+		{
+			name: "block storage",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							BlockStorage: &openstack.CloudProviderBlockStorage{
+								BSVersion:             "v3",
+								IgnoreVolumeAZ:        true,
+								TrustDevicePath:       true,
+								NodeVolumeAttachLimit: pointer.Int(25),
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[BlockStorage]
+bs-version = v3
+ignore-volume-az = true
+trust-device-path = true
+node-volume-attach-limit = 25
+`,
+		},
+		{
+			name: "empty block storage",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							BlockStorage: &openstack.CloudProviderBlockStorage{},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+`,
+		},
+		{
+			name: "invalid node volume attach limit",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							BlockStorage: &openstack.CloudProviderBlockStorage{
+								NodeVolumeAttachLimit: pointer.Int(0),
+							},
+						},
+					},
+				},
+			},
+			expectedError: "invalid node-volume-attach-limit: 0 is not between 1 and 256",
+		},
+		{
+			name: "metadata",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Metadata: &openstack.CloudProviderMetadata{
+								SearchOrder:    "configDrive, metadataService",
+								RequestTimeout: "30s",
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[Metadata]
+search-order = configDrive,metadataService
+request-timeout = 30s
+`,
+		},
+		{
+			name: "metadata request timeout in minutes",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Metadata: &openstack.CloudProviderMetadata{
+								RequestTimeout: "1m",
+							},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+
+[Metadata]
+request-timeout = 60s
+`,
+		},
+		{
+			name: "invalid metadata request timeout",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Metadata: &openstack.CloudProviderMetadata{
+								RequestTimeout: "30",
+							},
+						},
+					},
+				},
+			},
+			expectedError: `invalid request-timeout: time: missing unit in duration "30"`,
+		},
+		{
+			name: "empty metadata",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Metadata: &openstack.CloudProviderMetadata{},
+						},
+					},
+				},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-id = "default"
+domain-name = "Default"
+region = "my_region"
+`,
+		},
+		{
+			name: "invalid metadata search order",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Metadata: &openstack.CloudProviderMetadata{
+								SearchOrder: "configDrive,ec2",
+							},
+						},
+					},
+				},
+			},
+			expectedError: `invalid search-order: unknown metadata source "ec2", must be configDrive or metadataService`,
+		},
+		{
+			name: "several invalid settings",
+			installConfig: &types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							BlockStorage: &openstack.CloudProviderBlockStorage{
+								NodeVolumeAttachLimit: pointer.Int(0),
+							},
+							Metadata: &openstack.CloudProviderMetadata{
+								SearchOrder: "configDrive,ec2",
+							},
+						},
+					},
+				},
+			},
+			expectedError: `invalid node-volume-attach-limit: 0 is not between 1 and 256
+invalid search-order: unknown metadata source "ec2", must be configDrive or metadataService`,
+		},
+	}
+
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			Username:   "my_user",
+			Password:   "my_secret_password",
+			AuthURL:    "https://my_auth_url.com/v3/",
+			ProjectID:  "f12f928576ae4d21bdb984da5dd1d3bf",
+			DomainID:   "default",
+			DomainName: "Default",
+		},
+		RegionName: "my_region",
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actualConfig, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(*tc.installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, actualConfig, "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigCredentialsSecret(t *testing.T) {
+	cases := []struct {
+		name           string
+		config         *openstack.CloudProviderConfig
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name: "default",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`,
+		},
+		{
+			name: "custom",
+			config: &openstack.CloudProviderConfig{
+				SecretName:      "my-credentials",
+				SecretNamespace: "openstack-system",
+			},
+			expectedConfig: `[Global]
+secret-name = my-credentials
+secret-namespace = openstack-system
+`,
+		},
+		{
+			name: "custom name only",
+			config: &openstack.CloudProviderConfig{
+				SecretName: "my-credentials",
+			},
+			expectedConfig: `[Global]
+secret-name = my-credentials
+secret-namespace = kube-system
+`,
+		},
+		{
+			name: "invalid name",
+			config: &openstack.CloudProviderConfig{
+				SecretName: "My_Credentials",
+			},
+			expectedError: `invalid secret-name "My_Credentials": a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters`,
+		},
+		{
+			name: "invalid namespace",
+			config: &openstack.CloudProviderConfig{
+				SecretNamespace: "openstack.system",
+			},
+			expectedError: `invalid secret-namespace "openstack.system": must not contain dots`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: tc.config,
+					},
+				},
+			}
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, config)
+		})
+	}
+}
+
+func TestCloudProviderConfigRegion(t *testing.T) {
+	cases := []struct {
+		name           string
+		region         string
+		expectedRegion string
+		expectedError  string
+	}{
+		{
+			name:           "override",
+			region:         "region_two",
+			expectedRegion: "region_two",
+		},
+		{
+			name:           "fallback",
+			expectedRegion: "region_one",
+		},
+		{
+			name:          "blank",
+			region:        "  ",
+			expectedError: `invalid region "  ": the region is blank`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   &clientconfig.AuthInfo{Username: "my_user", Password: "my_secret_password"},
+				RegionName: "region_one",
+			}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Region: tc.region,
+						},
+					},
+				},
+			}
+
+			secretConfig, secretErr := CloudProviderConfigSecret(&cloud, WithRegion(tc.region))
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, secretErr, tc.expectedError)
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			expectedLine := "region = " + strconv.Quote(tc.expectedRegion) + "\n"
+			assert.NoError(t, secretErr)
+			assert.Contains(t, string(secretConfig), expectedLine)
+			assert.NoError(t, err)
+			assert.Contains(t, config, expectedLine)
+		})
+	}
+}
+
+func TestCloudProviderConfigEndpointType(t *testing.T) {
+	cases := []struct {
+		endpointType  string
+		expectedLine  string
+		expectedError string
+	}{
+		{
+			endpointType: "public",
+			expectedLine: "os-endpoint-type = public\n",
+		},
+		{
+			endpointType: "internal",
+			expectedLine: "os-endpoint-type = internal\n",
+		},
+		{
+			endpointType: "admin",
+			expectedLine: "os-endpoint-type = admin\n",
+		},
+		{
+			endpointType:  "private",
+			expectedError: `invalid os-endpoint-type: unsupported endpoint type "private", must be public, internal or admin`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.endpointType, func(t *testing.T) {
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							EndpointType: tc.endpointType,
+						},
+					},
+				},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, config, tc.expectedLine)
+		})
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+		installConfig := types.InstallConfig{
+			Networking: &types.Networking{},
+			Platform: types.Platform{
+				OpenStack: &openstack.Platform{
+					CloudProviderConfig: &openstack.CloudProviderConfig{},
+				},
+			},
+		}
+
+		config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+		assert.NoError(t, err)
+		assert.NotContains(t, config, "os-endpoint-type")
+	})
+}
+
+func TestCloudProviderConfigIdentityAPIVersion(t *testing.T) {
+	cases := []struct {
+		name               string
+		identityAPIVersion string
+		auth               clientconfig.AuthInfo
+		expectedLine       string
+		expectedError      string
+	}{
+		{
+			name:               "v2",
+			identityAPIVersion: "2",
+			expectedLine:       "identity-api-version = 2\n",
+		},
+		{
+			name:               "v3",
+			identityAPIVersion: "3",
+			expectedLine:       "identity-api-version = 3\n",
+		},
+		{
+			name:               "unsupported version",
+			identityAPIVersion: "2.0",
+			expectedError:      `invalid identity-api-version: unsupported identity API version "2.0", must be 2 or 3`,
+		},
+		{
+			name:               "v2 with v3-only settings",
+			identityAPIVersion: "2",
+			auth:               clientconfig.AuthInfo{UserDomainName: "Default"},
+			expectedError:      "invalid identity_api_version 2: identity API v3 is required by user_domain_name",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{AuthInfo: &tc.auth}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							IdentityAPIVersion: tc.identityAPIVersion,
+						},
+					},
+				},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, config, tc.expectedLine)
+		})
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}, IdentityAPIVersion: "3"}
+		installConfig := types.InstallConfig{
+			Networking: &types.Networking{},
+			Platform: types.Platform{
+				OpenStack: &openstack.Platform{
+					CloudProviderConfig: &openstack.CloudProviderConfig{},
+				},
+			},
+		}
+
+		config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+		assert.NoError(t, err)
+		assert.NotContains(t, config, "identity-api-version")
+	})
+}
+
+func TestCloudProviderConfigStrictRegion(t *testing.T) {
+	cases := []struct {
+		name          string
+		strict        bool
+		regions       []clientconfig.Region
+		region        string
+		expectedError string
+	}{
+		{
+			name:          "strict with an empty region",
+			strict:        true,
+			regions:       []clientconfig.Region{{Name: "region_one"}, {Name: "region_two"}},
+			expectedError: "missing region: the cloud has several regions (region_one, region_two) but none is selected",
+		},
+		{
+			name:    "not strict with an empty region",
+			regions: []clientconfig.Region{{Name: "region_one"}, {Name: "region_two"}},
+		},
+		{
+			name:    "strict with an overridden region",
+			strict:  true,
+			regions: []clientconfig.Region{{Name: "region_one"}, {Name: "region_two"}},
+			region:  "region_two",
+		},
+		{
+			name:    "strict with a single region",
+			strict:  true,
+			regions: []clientconfig.Region{{Name: "region_one"}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{Username: "my_user", Password: "my_secret_password"},
+				Regions:  tc.regions,
+			}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Region: tc.region,
+						},
+					},
+				},
+			}
+
+			_, secretErr := CloudProviderConfigSecret(&cloud, WithRegion(tc.region), WithStrict(tc.strict))
+			_, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), WithStrict(tc.strict))
+			if tc.expectedError != "" {
+				assert.EqualError(t, secretErr, tc.expectedError)
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, secretErr)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCloudProviderConfigInlineCredentials(t *testing.T) {
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caCertFile, []byte(testCACert), 0o600)
+	assert.NoError(t, err)
+
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			Username:   "my_user",
+			Password:   "my_secret_password",
+			AuthURL:    "https://my_auth_url.com/v3/",
+			ProjectID:  "f12f928576ae4d21bdb984da5dd1d3bf",
+			DomainID:   "default",
+			DomainName: "Default",
+		},
+		RegionName: "my_region",
+		CACertFile: caCertFile,
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				CloudProviderConfig: &openstack.CloudProviderConfig{
+					Metadata: &openstack.CloudProviderMetadata{
+						SearchOrder: "configDrive",
+					},
+				},
+			},
+		},
+	}
+
+	secretConfig, err := CloudProviderConfigSecret(&cloud)
+	assert.NoError(t, err, "failed to create cloud provider config")
+
+	config, caBundle, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), WithInlineCredentials())
+	assert.NoError(t, err, "unexpected error when generating cloud provider config")
+	assert.Equal(t, string(secretConfig)+"\n[Metadata]\nsearch-order = configDrive\n", config)
+	assert.Equal(t, testCACert, caBundle)
+
+	_, _, err = generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), WithInlineCredentials(), WithCloudsFile("/etc/openstack/clouds.yaml", "openstack"))
+	assert.EqualError(t, err, "invalid inline credentials: conflicts with the clouds file /etc/openstack/clouds.yaml")
+}
+
+func TestCloudProviderConfigCAFile(t *testing.T) {
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caCertFile, []byte(testCACert), 0o600)
+	assert.NoError(t, err)
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+
+	cases := []struct {
+		name           string
+		opts           []Option
+		expectedCAFile string
+	}{
+		{
+			name:           "default path",
+			expectedCAFile: CABundleMountPath,
+		},
+		{
+			name:           "custom path",
+			opts:           []Option{WithCAFile("/etc/openstack/custom-ca.pem")},
+			expectedCAFile: "/etc/openstack/custom-ca.pem",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   &clientconfig.AuthInfo{Username: "my_user", Password: "my_secret_password"},
+				CACertFile: caCertFile,
+			}
+			expectedLine := "ca-file = " + strconv.Quote(tc.expectedCAFile) + "\n"
+
+			secretConfig, err := CloudProviderConfigSecret(&cloud, tc.opts...)
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Contains(t, string(secretConfig), expectedLine)
+
+			config, caBundle, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), tc.opts...)
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Contains(t, config, expectedLine)
+			assert.Equal(t, testCACert, caBundle)
+		})
+	}
+}
+
+func TestValidateCABundle(t *testing.T) {
+	cases := []struct {
+		name          string
+		caBundle      string
+		expectedError string
+	}{
+		{
+			name:     "single certificate",
+			caBundle: testCACert,
+		},
+		{
+			name:     "bundle",
+			caBundle: testCABundle,
+		},
+		{
+			name:          "empty file",
+			expectedError: "no PEM certificate found",
+		},
+		{
+			name:          "garbage",
+			caBundle:      "my_ca_bundle",
+			expectedError: "no PEM certificate found",
+		},
+		{
+			name:          "corrupted certificate",
+			caBundle:      testCACert + "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+			expectedError: "certificate 2: x509: malformed certificate",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateCABundle([]byte(tc.caBundle))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+
+	t.Run("cloud provider config", func(t *testing.T) {
+		caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+		err := os.WriteFile(caCertFile, []byte("my_ca_bundle"), 0o600)
+		assert.NoError(t, err)
+
+		cloud := clientconfig.Cloud{
+			AuthInfo:   &clientconfig.AuthInfo{},
+			CACertFile: caCertFile,
+		}
+		installConfig := types.InstallConfig{
+			Networking: &types.Networking{},
+			Platform: types.Platform{
+				OpenStack: &openstack.Platform{},
+			},
+		}
+		_, _, err = generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+		assert.EqualError(t, err, "invalid clouds.yaml ca-cert "+caCertFile+": no PEM certificate found")
+	})
+}
+
+func TestCloudProviderConfigInlineCABundle(t *testing.T) {
+	caBundle := []byte(strings.ReplaceAll(testCACert, "\n", "\r\n") + "\n")
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caCertFile, caBundle, 0o600)
+	assert.NoError(t, err)
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+	cloud := clientconfig.Cloud{
+		AuthInfo:   &clientconfig.AuthInfo{},
+		CACertFile: caCertFile,
+	}
+
+	cases := []struct {
+		name           string
+		opts           []Option
+		expectedConfig string
+	}{
+		{
+			name: "file reference",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+ca-file = "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem"
+`,
+		},
+		{
+			name: "inline",
+			opts: []Option{WithInlineCABundle()},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, actualCABundle, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), tc.opts...)
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, config)
+			assert.Equal(t, string(caBundle), actualCABundle)
+		})
+	}
+}
+
+func TestCloudProviderConfigBase64CABundle(t *testing.T) {
+	cases := []struct {
+		name             string
+		caBundle         string
+		caCertFile       string
+		expectedConfig   string
+		expectedCABundle string
+		expectedError    string
+	}{
+		{
+			name:     "valid bundle",
+			caBundle: base64.StdEncoding.EncodeToString([]byte(testCABundle)),
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+ca-file = "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem"
+`,
+			expectedCABundle: testCABundle,
+		},
+		{
+			name:       "valid bundle replacing the clouds.yaml ca-cert",
+			caBundle:   base64.StdEncoding.EncodeToString([]byte(testCACert)) + "\n",
+			caCertFile: "/missing/ca.pem",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+ca-file = "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem"
+`,
+			expectedCABundle: testCACert,
+		},
+		{
+			name:          "malformed base64",
+			caBundle:      "not base64!",
+			expectedError: "invalid CA bundle of the cloud provider config: illegal base64 data at input byte 3",
+		},
+		{
+			name:          "not PEM",
+			caBundle:      base64.StdEncoding.EncodeToString([]byte("not a certificate")),
+			expectedError: "invalid CA bundle of the cloud provider config: no PEM certificate found",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							CABundle: tc.caBundle,
+						},
+					},
+				},
+			}
+			cloud := clientconfig.Cloud{
+				AuthInfo:   &clientconfig.AuthInfo{},
+				CACertFile: tc.caCertFile,
+			}
+
+			config, caBundle, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, config)
+			assert.Equal(t, tc.expectedCABundle, caBundle)
+			assert.Equal(t, tc.caCertFile, cloud.CACertFile, "the cloud must not be modified")
+		})
+	}
+}
+
+func TestCloudProviderConfigCABundleSize(t *testing.T) {
+	largeBundle := strings.Repeat(testCACert, defaultMaxCABundleSize/len(testCACert)+1)
+
+	cases := []struct {
+		name          string
+		caBundle      string
+		opts          []Option
+		expectedError string
+	}{
+		{
+			name:     "under the default limit",
+			caBundle: testCACert,
+		},
+		{
+			name:          "over the default limit",
+			caBundle:      largeBundle,
+			expectedError: fmt.Sprintf("invalid CA bundle: the bundle is %d bytes, over the limit of %d bytes", len(largeBundle), defaultMaxCABundleSize),
+		},
+		{
+			name:     "at the limit",
+			caBundle: testCACert,
+			opts:     []Option{WithMaxCABundleSize(len(testCACert))},
+		},
+		{
+			name:          "over the limit",
+			caBundle:      testCACert,
+			opts:          []Option{WithMaxCABundleSize(len(testCACert) - 1)},
+			expectedError: fmt.Sprintf("invalid CA bundle: the bundle is %d bytes, over the limit of %d bytes", len(testCACert), len(testCACert)-1),
+		},
+		{
+			name:     "limit disabled",
+			caBundle: largeBundle,
+			opts:     []Option{WithMaxCABundleSize(0)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							CABundle: base64.StdEncoding.EncodeToString([]byte(tc.caBundle)),
+						},
+					},
+				},
+			}
+
+			_, caBundle, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), tc.opts...)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.caBundle, caBundle)
+		})
+	}
+}
+
+func TestCloudProviderConfigRelativeCAFile(t *testing.T) {
+	dir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(dir, "certs"), 0o700)
+	assert.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "certs", "ca.pem"), []byte(testCACert), 0o600)
+	assert.NoError(t, err)
+	err = os.Symlink(filepath.Join("certs", "ca.pem"), filepath.Join(dir, "ca-link.pem"))
+	assert.NoError(t, err)
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+
+	cases := []struct {
+		name          string
+		caCertFile    string
+		expectedError string
+	}{
+		{
+			name:       "relative path",
+			caCertFile: "certs/ca.pem",
+		},
+		{
+			name:       "symlink",
+			caCertFile: "ca-link.pem",
+		},
+		{
+			name:          "missing file",
+			caCertFile:    "missing.pem",
+			expectedError: "failed to read clouds.yaml ca-cert from disk at " + filepath.Join(dir, "missing.pem"),
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   &clientconfig.AuthInfo{},
+				CACertFile: tc.caCertFile,
+			}
+
+			_, caBundle, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), WithCloudsYAMLDir(dir))
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, testCACert, caBundle)
+		})
+	}
+}
+
+func TestCloudProviderConfigCAFileFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"etc/openstack/ca.pem":       {Data: []byte(testCACert)},
+		"etc/openstack/certs/ca.pem": {Data: []byte(testCABundle)},
+	}
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+
+	cases := []struct {
+		name             string
+		caCertFile       string
+		cloudsYAMLDir    string
+		expectedCABundle string
+		expectedError    string
+	}{
+		{
+			name:             "absolute path",
+			caCertFile:       "/etc/openstack/ca.pem",
+			expectedCABundle: testCACert,
+		},
+		{
+			name:             "relative path",
+			caCertFile:       "certs/ca.pem",
+			cloudsYAMLDir:    "/etc/openstack",
+			expectedCABundle: testCABundle,
+		},
+		{
+			name:          "missing file",
+			caCertFile:    "/etc/openstack/missing.pem",
+			expectedError: "failed to read clouds.yaml ca-cert at etc/openstack/missing.pem: open etc/openstack/missing.pem: file does not exist",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   &clientconfig.AuthInfo{},
+				CACertFile: tc.caCertFile,
+			}
+
+			_, caBundle, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), WithFS(fsys), WithCloudsYAMLDir(tc.cloudsYAMLDir))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedCABundle, caBundle)
+		})
+	}
+}
+
+// signalingFS is a filesystem that closes opened when a file is first opened.
+type signalingFS struct {
+	fs.FS
+	opened chan struct{}
+	once   *sync.Once
+}
+
+func (f signalingFS) Open(name string) (fs.File, error) {
+	f.once.Do(func() { close(f.opened) })
+	return f.FS.Open(name)
+}
+
+// slowNetworkResolver is a network resolver whose network name lookups only
+// complete once release is closed, or fail when their context is done. The
+// error of the context is sent to done.
+type slowNetworkResolver struct {
+	fakeNetworkResolver
+	release <-chan struct{}
+	done    chan<- error
+}
+
+func (r slowNetworkResolver) IDFromName(ctx context.Context, name string) (string, error) {
+	select {
+	case <-r.release:
+		return r.fakeNetworkResolver.IDFromName(ctx, name)
+	case <-ctx.Done():
+		r.done <- ctx.Err()
+		return "", ctx.Err()
+	}
+}
+
+func TestCloudProviderConfigConcurrentLookups(t *testing.T) {
+	networks := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				ExternalNetwork: "external",
+			},
+		},
+	}
+
+	t.Run("CA bundle read while the network is resolved", func(t *testing.T) {
+		fsys := signalingFS{
+			FS:     fstest.MapFS{"etc/openstack/ca.pem": {Data: []byte(testCACert)}},
+			opened: make(chan struct{}),
+			once:   new(sync.Once),
+		}
+		// The network lookup only completes once the CA bundle is read, so it
+		// would time out if the CA bundle was read after it.
+		resolver := slowNetworkResolver{fakeNetworkResolver: networks, release: fsys.opened, done: make(chan error, 1)}
+		cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}, CACertFile: "/etc/openstack/ca.pem"}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, caBundle, networkIDs, err := generateCloudProviderConfigAndNetworkIDs(ctx, resolver, &cloud, NewCloudProviderOptions(installConfig), WithFS(fsys))
+		assert.NoError(t, err)
+		assert.Equal(t, testCACert, caBundle)
+		assert.Equal(t, []string{"a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11"}, networkIDs)
+	})
+
+	t.Run("CA bundle failure cancelling the network lookup", func(t *testing.T) {
+		done := make(chan error, 1)
+		resolver := slowNetworkResolver{fakeNetworkResolver: networks, release: make(chan struct{}), done: done}
+		cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}, CACertFile: "/etc/openstack/missing.pem"}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, _, err := generateCloudProviderConfig(ctx, resolver, &cloud, NewCloudProviderOptions(installConfig), WithFS(fstest.MapFS{}))
+		assert.EqualError(t, err, "failed to read clouds.yaml ca-cert at etc/openstack/missing.pem: open etc/openstack/missing.pem: file does not exist")
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		done := make(chan error, 1)
+		resolver := slowNetworkResolver{fakeNetworkResolver: networks, release: make(chan struct{}), done: done}
+		cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, _, err := generateCloudProviderConfig(ctx, resolver, &cloud, NewCloudProviderOptions(installConfig))
+		assert.EqualError(t, err, "failed to fetch external network external: context canceled")
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func TestWriteCloudProviderConfig(t *testing.T) {
+	neutron := newFakeNeutron(t, fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true})
+	setCloudsYAML(t, newFakeKeystone(t, neutron))
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				Cloud:           "openstack",
+				ExternalNetwork: "external",
+				CloudProviderConfig: &openstack.CloudProviderConfig{
+					Networking: &openstack.CloudProviderNetworking{
+						PublicNetworkNames: []string{"public"},
+					},
+					LoadBalancer: &openstack.CloudProviderLoadBalancer{
+						Provider: "ovn",
+					},
+					BlockStorage: &openstack.CloudProviderBlockStorage{
+						IgnoreVolumeAZ: true,
+					},
+					Metadata: &openstack.CloudProviderMetadata{
+						SearchOrder: "configDrive",
+					},
+				},
+			},
+		},
+	}
+
+	expectedConfig, _, err := GenerateCloudProviderConfig(context.Background(), installConfig)
+	assert.NoError(t, err, "unexpected error when generating cloud provider config")
+	assert.Contains(t, expectedConfig, "floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11\n")
+
+	var actualConfig bytes.Buffer
+	_, err = WriteCloudProviderConfig(context.Background(), &actualConfig, installConfig)
+	assert.NoError(t, err, "unexpected error when writing cloud provider config")
+	assert.Equal(t, expectedConfig, actualConfig.String(), "unexpected cloud provider config")
+}
+
+func TestCloudProviderConfigCredentials(t *testing.T) {
+	cloud := clientconfig.Cloud{
+		AuthInfo:   &clientconfig.AuthInfo{},
+		RegionName: "my_region",
+	}
+
+	cases := []struct {
+		name           string
+		platformCloud  string
+		opts           []Option
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name: "credentials secret",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+region = "my_region"
+`,
+		},
+		{
+			name: "clouds file",
+			opts: []Option{WithCloudsFile("/etc/openstack/clouds.yaml", "openstack")},
+			expectedConfig: `[Global]
+use-clouds = true
+clouds-file = "/etc/openstack/clouds.yaml"
+cloud = "openstack"
+region = "my_region"
+`,
+		},
+		{
+			name:          "clouds file with the cloud of the install config",
+			platformCloud: "openstack",
+			opts:          []Option{WithCloudsFile("/etc/openstack/clouds.yaml", "")},
+			expectedConfig: `[Global]
+use-clouds = true
+clouds-file = "/etc/openstack/clouds.yaml"
+cloud = "openstack"
+region = "my_region"
+`,
+		},
+		{
+			name:          "clouds file cloud name over the cloud of the install config",
+			platformCloud: "openstack",
+			opts:          []Option{WithCloudsFile("/etc/openstack/clouds.yaml", "other")},
+			expectedConfig: `[Global]
+use-clouds = true
+clouds-file = "/etc/openstack/clouds.yaml"
+cloud = "other"
+region = "my_region"
+`,
+		},
+		{
+			name:          "clouds file without cloud name",
+			opts:          []Option{WithCloudsFile("/etc/openstack/clouds.yaml", "")},
+			expectedError: "invalid clouds file /etc/openstack/clouds.yaml: a cloud name is required",
+		},
+		{
+			name:          "clouds file with a blank cloud name",
+			platformCloud: " ",
+			opts:          []Option{WithCloudsFile("/etc/openstack/clouds.yaml", "")},
+			expectedError: "invalid clouds file /etc/openstack/clouds.yaml: a cloud name is required",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{Cloud: tc.platformCloud},
+				},
+			}
+
+			actualConfig, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), tc.opts...)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, actualConfig, "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigQuoting(t *testing.T) {
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+
+	for _, region := range []string{"us-east#1", "us-east;1", `us "east" \1`} {
+		t.Run(region, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   &clientconfig.AuthInfo{},
+				RegionName: region,
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+
+			var parsed struct {
+				Global struct {
+					SecretName      string `gcfg:"secret-name"`
+					SecretNamespace string `gcfg:"secret-namespace"`
+					Region          string `gcfg:"region"`
+				}
+			}
+			err = gcfg.ReadStringInto(&parsed, config)
+			assert.NoError(t, err, "failed to parse cloud provider config")
+			assert.Equal(t, region, parsed.Global.Region, "region didn't survive a gcfg round-trip")
+		})
+	}
+}
+
+func TestQuoteValue(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected string
+	}{
+		{
+			name:     "regular",
+			value:    "regular",
+			expected: `"regular"`,
+		},
+		{
+			name:     "hash",
+			value:    "us-east#1",
+			expected: `"us-east#1"`,
+		},
+		{
+			name:     "semicolon",
+			value:    "us-east;1",
+			expected: `"us-east;1"`,
+		},
+		{
+			name:     "quotes",
+			value:    `us "east"`,
+			expected: `"us \"east\""`,
+		},
+		{
+			name:     "backslashes",
+			value:    `C:\certs\`,
+			expected: `"C:\\certs\\"`,
+		},
+		{
+			name:     "trailing spaces",
+			value:    "secret  ",
+			expected: `"secret  "`,
+		},
+		{
+			name:     "leading spaces",
+			value:    "  secret",
+			expected: `"  secret"`,
+		},
+		{
+			name:     "newline and tab",
+			value:    "line\n\tindented",
+			expected: `"line\n\tindented"`,
+		},
+		{
+			name:     "control character",
+			value:    "bell\a",
+			expected: "\"bell\a\"",
+		},
+		{
+			name:     "unicode",
+			value:    "région",
+			expected: `"région"`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			quoted := quoteValue(tc.value)
+			assert.Equal(t, tc.expected, quoted)
+
+			var parsed struct {
+				Global struct {
+					Value string `gcfg:"value"`
+				}
+			}
+			err := gcfg.ReadStringInto(&parsed, "[Global]\nvalue = "+quoted+"\n")
+			assert.NoError(t, err, "failed to parse quoted value")
+			assert.Equal(t, tc.value, parsed.Global.Value, "value didn't survive a gcfg round-trip")
+		})
+	}
+}
+
+func TestCloudProviderConfigLoadBalancer(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name            string
+		externalNetwork string
+		loadBalancer    *openstack.CloudProviderLoadBalancer
+		expectedConfig  string
+		expectedError   string
+	}{
+		{
+			name:            "security groups managed",
+			externalNetwork: "external",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				ManageSecurityGroups: pointer.Bool(true),
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+manage-security-groups = true
+`,
+		},
+		{
+			name:            "security groups not managed",
+			externalNetwork: "external",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				ManageSecurityGroups: pointer.Bool(false),
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+manage-security-groups = false
+`,
+		},
+		{
+			name:            "security groups unset",
+			externalNetwork: "external",
+			loadBalancer:    &openstack.CloudProviderLoadBalancer{},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+`,
+		},
+		{
+			name: "octavia disabled",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				UseOctavia: pointer.Bool(false),
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+use-octavia = false
+`,
+		},
+		{
+			name: "octavia disabled with ovn provider",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				UseOctavia: pointer.Bool(false),
+				Provider:   "ovn",
+			},
+			expectedError: "invalid use-octavia: lb-provider ovn requires Octavia",
+		},
+		{
+			name: "octavia enabled with ovn provider",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				UseOctavia: pointer.Bool(true),
+				Provider:   "ovn",
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+use-octavia = true
+lb-provider = ovn
+`,
+		},
+		{
+			name: "health monitors",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				MonitorMaxRetries: pointer.Int(3),
+				MonitorTimeout:    "3s",
+				MonitorDelay:      "5s",
+				CreateMonitor:     pointer.Bool(true),
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+create-monitor = true
+monitor-delay = 5s
+monitor-timeout = 3s
+monitor-max-retries = 3
+`,
+		},
+		{
+			name: "invalid monitor delay",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				MonitorDelay: "5",
+			},
+			expectedError: `invalid monitor-delay: time: missing unit in duration "5"`,
+		},
+		{
+			name: "invalid monitor timeout",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				MonitorTimeout: "soon",
+			},
+			expectedError: `invalid monitor-timeout: time: invalid duration "soon"`,
+		},
+		{
+			name: "invalid monitor max retries",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				MonitorMaxRetries: pointer.Int(-1),
+			},
+			expectedError: "invalid monitor-max-retries: -1 is not a positive integer",
+		},
+		{
+			name: "security groups managed without external network",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				ManageSecurityGroups: pointer.Bool(true),
+			},
+			expectedError: "invalid manage-security-groups: an external network is required",
+		},
+		{
+			name:            "security groups managed with ovn provider",
+			externalNetwork: "external",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				Provider:             "ovn",
+				ManageSecurityGroups: pointer.Bool(true),
+			},
+			expectedError: "invalid manage-security-groups: not supported by the ovn provider",
+		},
+		{
+			name: "internal load balancers",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				InternalLB: true,
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+internal-lb = true
+`,
+		},
+		{
+			name:            "internal load balancers with external network",
+			externalNetwork: "external",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				InternalLB: true,
+			},
+			expectedError: "invalid internal-lb: conflicts with the external network external",
+		},
+		{
+			name: "ingress hostname",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				EnableIngressHostname: true,
+				IngressHostnameSuffix: "lb.example.com",
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+enable-ingress-hostname = true
+ingress-hostname-suffix = lb.example.com
+`,
+		},
+		{
+			name: "ingress hostname with default suffix",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				EnableIngressHostname: true,
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+enable-ingress-hostname = true
+`,
+		},
+		{
+			name: "ingress hostname suffix without ingress hostname",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				IngressHostnameSuffix: "lb.example.com",
+			},
+			expectedError: "invalid ingress-hostname-suffix: requires enable-ingress-hostname",
+		},
+		{
+			name: "invalid ingress hostname suffix",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				EnableIngressHostname: true,
+				IngressHostnameSuffix: "lb.example.com.",
+			},
+			expectedError: `invalid ingress-hostname-suffix "lb.example.com.": a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character (e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')`,
+		},
+		{
+			name: "max shared load balancers",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				MaxSharedLB: pointer.Int(5),
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+max-shared-lb = 5
+`,
+		},
+		{
+			name: "no shared load balancers",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				MaxSharedLB: pointer.Int(0),
+			},
+			expectedError: "invalid max-shared-lb: 0 is not a positive integer",
+		},
+		{
+			name: "round robin method",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				Method: "ROUND_ROBIN",
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+lb-method = ROUND_ROBIN
+`,
+		},
+		{
+			name: "least connections method",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				Method: "LEAST_CONNECTIONS",
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+lb-method = LEAST_CONNECTIONS
+`,
+		},
+		{
+			name: "source IP method",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				Provider: "amphora",
+				Method:   "SOURCE_IP",
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+lb-provider = amphora
+lb-method = SOURCE_IP
+`,
+		},
+		{
+			name: "unsupported method",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				Method: "round_robin",
+			},
+			expectedError: `invalid lb-method: unsupported method "round_robin", must be ROUND_ROBIN, LEAST_CONNECTIONS or SOURCE_IP`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.externalNetwork,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: tc.loadBalancer,
+						},
+					},
+				},
+			}
+
+			actualConfig, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, actualConfig, "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigDisabledLoadBalancer(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name               string
+		externalNetwork    string
+		machinesSubnet     string
+		loadBalancer       *openstack.CloudProviderLoadBalancer
+		opts               []Option
+		expectedConfig     string
+		expectedNetworkIDs []string
+		expectedError      string
+	}{
+		{
+			name:            "default",
+			externalNetwork: "external",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+`,
+			expectedNetworkIDs: []string{"a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11"},
+		},
+		{
+			name:            "disabled",
+			externalNetwork: "missing",
+			machinesSubnet:  "missing-subnet",
+			loadBalancer:    &openstack.CloudProviderLoadBalancer{Disabled: true},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`,
+		},
+		{
+			name:            "disabled with the V2 cloud provider",
+			externalNetwork: "external",
+			loadBalancer:    &openstack.CloudProviderLoadBalancer{Disabled: true},
+			opts:            []Option{WithCCMVersion(V2)},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+enabled = false
+`,
+		},
+		{
+			name:         "disabled with the external cloud controller manager",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{Disabled: true},
+			opts:         []Option{WithLayout(ExternalCCM)},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = openshift-cloud-controller-manager
+
+[LoadBalancer]
+enabled = false
+`,
+		},
+		{
+			name:            "disabled with other settings",
+			externalNetwork: "external",
+			loadBalancer: &openstack.CloudProviderLoadBalancer{
+				Disabled:       true,
+				Provider:       "amphora",
+				FloatingSubnet: "fip",
+				MaxSharedLB:    pointer.Int(2),
+			},
+			expectedError: "invalid disabled load balancers: conflicts with lb-provider, floating subnet, max-shared-lb",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork:          tc.externalNetwork,
+						DeprecatedMachinesSubnet: tc.machinesSubnet,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: tc.loadBalancer,
+						},
+					},
+				},
+			}
+
+			actualConfig, _, networkIDs, err := generateCloudProviderConfigAndNetworkIDs(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig), tc.opts...)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, actualConfig, "unexpected cloud provider config")
+			assert.Equal(t, tc.expectedNetworkIDs, networkIDs)
+		})
+	}
+}
+
+func TestRenderLoadBalancerSection(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name            string
+		externalNetwork string
+		opts            LBOptions
+		expectedSection string
+		expectedError   string
+	}{
+		{
+			name: "no settings",
+		},
+		{
+			name:            "floating network",
+			externalNetwork: "external",
+			opts: LBOptions{
+				FloatingNetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+			},
+			expectedSection: `[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+`,
+		},
+		{
+			name: "floating network and subnet",
+			opts: LBOptions{
+				FloatingNetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+				FloatingSubnetID:  "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61",
+			},
+			expectedSection: `[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+floating-subnet-id = 7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61
+`,
+		},
+		{
+			name:            "octavia settings",
+			externalNetwork: "external",
+			opts: LBOptions{
+				FloatingNetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+				LoadBalancer: &openstack.CloudProviderLoadBalancer{
+					UseOctavia:           pointer.Bool(true),
+					Provider:             "amphora",
+					ManageSecurityGroups: pointer.Bool(true),
+				},
+			},
+			expectedSection: `[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+use-octavia = true
+lb-provider = amphora
+manage-security-groups = true
+`,
+		},
+		{
+			name: "health monitors without a floating network",
+			opts: LBOptions{
+				LoadBalancer: &openstack.CloudProviderLoadBalancer{
+					CreateMonitor: pointer.Bool(true),
+					MonitorDelay:  "5s",
+				},
+			},
+			expectedSection: `[LoadBalancer]
+create-monitor = true
+monitor-delay = 5s
+`,
+		},
+		{
+			name: "invalid setting",
+			opts: LBOptions{
+				LoadBalancer: &openstack.CloudProviderLoadBalancer{
+					MaxSharedLB: pointer.Int(0),
+				},
+			},
+			expectedError: "invalid max-shared-lb: 0 is not a positive integer",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			section, err := RenderLoadBalancerSection(tc.opts)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedSection, section)
+
+			if tc.opts.FloatingSubnetID != "" || (tc.opts.FloatingNetworkID != "" && tc.externalNetwork == "") {
+				return
+			}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.externalNetwork,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: tc.opts.LoadBalancer,
+						},
+					},
+				},
+			}
+			config, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			if section == "" {
+				assert.NotContains(t, config, "[LoadBalancer]")
+			} else {
+				assert.Contains(t, config, "\n"+section)
+			}
+		})
+	}
+}
+
+func TestCloudProviderConfigUserDomain(t *testing.T) {
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			Username:       "my_user",
+			Password:       "my_secret_password",
+			AuthURL:        "https://my_auth_url.com/v3/",
+			UserDomainName: "my_domain",
+		},
+	}
+
+	secretConfig, err := CloudProviderConfigSecret(&cloud)
+	assert.NoError(t, err, "failed to create cloud provider config")
+	assert.Equal(t, `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+domain-name = "my_domain"
+`, string(secretConfig), "unexpected cloud provider config")
+
+	config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+	assert.NoError(t, err, "unexpected error when generating cloud provider config")
+	assert.Equal(t, `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-name = "my_domain"
+`, config, "unexpected cloud provider config")
+}
+
+func TestCloudProviderConfigDomainScoping(t *testing.T) {
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+
+	cases := []struct {
+		name             string
+		auth             clientconfig.AuthInfo
+		expectedV1Domain string
+		expectedDomain   string
+	}{
+		{
+			name: "no domain",
+		},
+		{
+			name: "generic domain",
+			auth: clientconfig.AuthInfo{DomainID: "default", DomainName: "Default"},
+			expectedV1Domain: `domain-id = "default"
+domain-name = "Default"
+`,
+			expectedDomain: `domain-id = "default"
+domain-name = "Default"
+`,
+		},
+		{
+			name: "user domain",
+			auth: clientconfig.AuthInfo{UserDomainID: "my_user_domain_id", UserDomainName: "my_user_domain"},
+			expectedV1Domain: `domain-id = "my_user_domain_id"
+domain-name = "my_user_domain"
+`,
+			expectedDomain: `user-domain-id = "my_user_domain_id"
+user-domain-name = "my_user_domain"
+`,
+		},
+		{
+			name: "project domain",
+			auth: clientconfig.AuthInfo{ProjectDomainID: "my_project_domain_id", ProjectDomainName: "my_project_domain"},
+			expectedDomain: `project-domain-id = "my_project_domain_id"
+project-domain-name = "my_project_domain"
+`,
+		},
+		{
+			name: "user and project domains",
+			auth: clientconfig.AuthInfo{UserDomainID: "my_user_domain_id", ProjectDomainName: "my_project_domain"},
+			expectedV1Domain: `domain-id = "my_user_domain_id"
+`,
+			expectedDomain: `user-domain-id = "my_user_domain_id"
+project-domain-name = "my_project_domain"
+`,
+		},
+		{
+			name: "generic domain with a user domain",
+			auth: clientconfig.AuthInfo{DomainID: "default", UserDomainID: "my_user_domain_id"},
+			expectedV1Domain: `domain-id = "default"
+`,
+			expectedDomain: `user-domain-id = "my_user_domain_id"
+project-domain-id = "default"
+`,
+		},
+		{
+			name: "generic domain with a project domain",
+			auth: clientconfig.AuthInfo{DomainName: "Default", ProjectDomainName: "my_project_domain"},
+			expectedV1Domain: `domain-name = "Default"
+`,
+			expectedDomain: `user-domain-name = "Default"
+project-domain-name = "my_project_domain"
+`,
+		},
+		{
+			name: "generic domain overridden by both",
+			auth: clientconfig.AuthInfo{DomainID: "default", UserDomainID: "my_user_domain_id", ProjectDomainID: "my_project_domain_id"},
+			expectedV1Domain: `domain-id = "default"
+`,
+			expectedDomain: `user-domain-id = "my_user_domain_id"
+project-domain-id = "my_project_domain_id"
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			auth := tc.auth
+			auth.AuthURL = "https://my_auth_url.com/v3/"
+			auth.Username = "my_user"
+			auth.Password = "my_secret_password"
+			cloud := clientconfig.Cloud{AuthInfo: &auth}
+
+			// The V1 cloud provider only reads the generic domain keys.
+			secretConfig, err := CloudProviderConfigSecret(&cloud)
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+`+tc.expectedV1Domain, string(secretConfig), "unexpected cloud provider config")
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`+tc.expectedV1Domain, config, "unexpected cloud provider config")
+
+			secretConfig, err = CloudProviderConfigSecret(&cloud, WithCCMVersion(V2))
+			assert.NoError(t, err, "failed to create cloud provider config")
+			assert.Equal(t, `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+`+tc.expectedDomain, string(secretConfig), "unexpected cloud provider config")
+
+			config, _, err = generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), WithLayout(ExternalCCM))
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, `[Global]
+secret-name = openstack-credentials
+secret-namespace = openshift-cloud-controller-manager
+`+tc.expectedDomain, config, "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestGenerateCloudProviderConfigFromSession(t *testing.T) {
+	session := &installconfigopenstack.Session{
+		CloudConfig: &clientconfig.Cloud{
+			AuthInfo: &clientconfig.AuthInfo{
+				Username: "my_user",
+			},
+		},
+		ClientOpts: &clientconfig.ClientOpts{},
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+
+	_, _, err := GenerateCloudProviderConfigFromSession(context.Background(), session, installConfig)
+	assert.EqualError(t, err, "incomplete authentication settings in clouds.yaml: missing auth_url\nmissing password")
+}
+
+// memoryCloudsYAML serves clouds.yaml from memory, like the session of a
+// caller that doesn't hold it on disk.
+type memoryCloudsYAML map[string]clientconfig.Cloud
+
+func (m memoryCloudsYAML) LoadCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return m, nil
+}
+
+func (m memoryCloudsYAML) LoadSecureCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return nil, nil
+}
+
+func (m memoryCloudsYAML) LoadPublicCloudsYAML() (map[string]clientconfig.Cloud, error) {
+	return nil, nil
+}
+
+func TestGenerateCloudProviderConfigFromSessionInMemory(t *testing.T) {
+	neutron := newFakeNeutron(t, fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true})
+	authURL := newFakeKeystone(t, neutron)
+	// The local clouds.yaml file must be left alone, its directory included.
+	setCloudsYAML(t, authURL)
+
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:        authURL,
+			Username:       "my_user",
+			Password:       "my_secret_password",
+			ProjectID:      "f12f928576ae4d21bdb984da5dd1d3bf",
+			UserDomainName: "Default",
+		},
+		RegionName: "my_region",
+	}
+	// The client of the session authenticates against the fake Keystone, while
+	// the cloud the config is generated from points at the TLS endpoint its
+	// CA bundle is for.
+	sessionAuth := *cloud.AuthInfo
+	sessionAuth.AuthURL = "https://keystone.example.com:5000/v3"
+	sessionCloud := cloud
+	sessionCloud.AuthInfo = &sessionAuth
+	sessionCloud.CACertFile = "ca.pem"
+	session := &installconfigopenstack.Session{
+		CloudConfig: &sessionCloud,
+		ClientOpts: &clientconfig.ClientOpts{
+			Cloud:    "openstack",
+			YAMLOpts: memoryCloudsYAML{"openstack": cloud},
+		},
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				Cloud:           "openstack",
+				ExternalNetwork: "external",
+			},
+		},
+	}
+
+	cases := []struct {
+		name string
+		opts []Option
+	}{
+		{
+			name: "no clouds.yaml directory",
+			opts: []Option{WithFS(fstest.MapFS{"ca.pem": {Data: []byte(testCACert)}})},
+		},
+		{
+			name: "clouds.yaml directory option",
+			opts: []Option{
+				WithCloudsYAMLDir("/etc/openstack"),
+				WithFS(fstest.MapFS{"etc/openstack/ca.pem": {Data: []byte(testCACert)}}),
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, caBundle, err := GenerateCloudProviderConfigFromSession(context.Background(), session, installConfig, tc.opts...)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, testCACert, caBundle)
+			assert.Contains(t, config, "floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11\n")
+			assert.Contains(t, config, `ca-file = "`+CABundleMountPath+`"`)
+		})
+	}
+}
+
+func TestCloudProviderConfigGolden(t *testing.T) {
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caCertFile, []byte(testCACert), 0o600)
+	assert.NoError(t, err)
+
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+		subnets: []fakeSubnet{
+			{ID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61", Name: "fip", NetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11"},
+		},
+		routers: []fakeRouter{
+			{ID: "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51", Name: "router"},
+		},
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				ExternalNetwork: "external",
+				CloudProviderConfig: &openstack.CloudProviderConfig{
+					Route: &openstack.CloudProviderRoute{
+						Router: "router",
+					},
+					Metadata: &openstack.CloudProviderMetadata{
+						SearchOrder:    "configDrive,metadataService",
+						RequestTimeout: "10s",
+					},
+					BlockStorage: &openstack.CloudProviderBlockStorage{
+						BSVersion:             "v3",
+						IgnoreVolumeAZ:        true,
+						TrustDevicePath:       true,
+						NodeVolumeAttachLimit: pointer.Int(25),
+					},
+					LoadBalancer: &openstack.CloudProviderLoadBalancer{
+						UseOctavia:           pointer.Bool(true),
+						Provider:             "amphora",
+						FloatingSubnet:       "fip",
+						ManageSecurityGroups: pointer.Bool(true),
+						CreateMonitor:        pointer.Bool(true),
+						MonitorDelay:         "5s",
+						MonitorTimeout:       "3s",
+						MonitorMaxRetries:    pointer.Int(1),
+					},
+					Networking: &openstack.CloudProviderNetworking{
+						PublicNetworkNames:   []string{"public"},
+						InternalNetworkNames: []string{"private"},
+						IPv6SupportDisabled:  pointer.Bool(true),
+						AddressSortOrder:     "192.168.0.0/16",
+					},
+				},
+			},
+		},
+	}
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			DomainID:   "default",
+			DomainName: "Default",
+		},
+		RegionName: "my_region",
+		CACertFile: caCertFile,
+	}
+
+	expectedConfig, err := os.ReadFile(filepath.Join("testdata", "cloud-provider-config.golden"))
+	assert.NoError(t, err)
+
+	actualConfig, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+	assert.NoError(t, err, "unexpected error when generating cloud provider config")
+	assert.Equal(t, string(expectedConfig), actualConfig, "unexpected cloud provider config")
+}
+
+// TestCloudProviderConfigDeterministic generates a config with every setting
+// many times, concurrently so that running the tests with -race also checks
+// that the generation doesn't share any state, and expects the same output
+// every time.
+func TestCloudProviderConfigDeterministic(t *testing.T) {
+	const runs = 100
+
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caCertFile, []byte(testCACert), 0o600)
+	assert.NoError(t, err)
+
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+			{ID: "b1fa7de2-3f47-4f3b-8c9b-9c4e9d2f4b22", Name: "external-2", External: true},
+		},
+		subnets: []fakeSubnet{
+			{ID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61", Name: "fip", NetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11"},
+		},
+		routers: []fakeRouter{
+			{ID: "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51", Name: "router"},
+		},
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				ExternalNetwork: "external",
+				CloudProviderConfig: &openstack.CloudProviderConfig{
+					EndpointType: "internal",
+					Route: &openstack.CloudProviderRoute{
+						Router: "router",
+					},
+					Metadata: &openstack.CloudProviderMetadata{
+						SearchOrder:    "configDrive,metadataService",
+						RequestTimeout: "10s",
+					},
+					BlockStorage: &openstack.CloudProviderBlockStorage{
+						BSVersion:             "v3",
+						IgnoreVolumeAZ:        true,
+						TrustDevicePath:       true,
+						NodeVolumeAttachLimit: pointer.Int(25),
+					},
+					LoadBalancer: &openstack.CloudProviderLoadBalancer{
+						UseOctavia:                 pointer.Bool(true),
+						Provider:                   "amphora",
+						AdditionalExternalNetworks: []string{"external-2"},
+						FloatingSubnet:             "fip",
+						ManageSecurityGroups:       pointer.Bool(true),
+						EnableIngressHostname:      true,
+						IngressHostnameSuffix:      "example.com",
+						MaxSharedLB:                pointer.Int(2),
+						CreateMonitor:              pointer.Bool(true),
+						MonitorDelay:               "5s",
+						MonitorTimeout:             "3s",
+						MonitorMaxRetries:          pointer.Int(1),
+					},
+					Networking: &openstack.CloudProviderNetworking{
+						PublicNetworkNames:               []string{"public", "public-v6"},
+						PublicNetworkFromExternalNetwork: true,
+						InternalNetworkNames:             []string{"private", "private-v6"},
+						IPv6SupportDisabled:              pointer.Bool(true),
+						AddressSortOrder:                 "192.168.0.0/16, 10.0.0.0/8",
+					},
+				},
+			},
+		},
+	}
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:         "https://my_auth_url.com/v3/",
+			UserID:          "my_user_id",
+			Password:        "my_secret_password",
+			ProjectID:       "f12f928576ae4d21bdb984da5dd1d3bf",
+			UserDomainID:    "default",
+			ProjectDomainID: "default",
+		},
+		RegionName: "my_region",
+		CACertFile: caCertFile,
+	}
+	opts := []Option{WithInlineCredentials(), WithHeader("Generated by the installer.")}
+
+	expectedConfig, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig), opts...)
+	assert.NoError(t, err, "unexpected error when generating cloud provider config")
+
+	configs := make([]string, runs)
+	errs := make([]error, runs)
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			configs[i], _, errs[i] = generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig), opts...)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < runs; i++ {
+		assert.NoError(t, errs[i], "unexpected error when generating cloud provider config")
+		assert.Equal(t, expectedConfig, configs[i], "run %d generated a different config", i)
+	}
+}
+
+func TestCloudProviderConfigIgnoreVolumeAZ(t *testing.T) {
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+	zonedPool := &types.MachinePool{
+		Platform: types.MachinePoolPlatform{
+			OpenStack: &openstack.MachinePool{
+				RootVolume: &openstack.RootVolume{
+					Zones: []string{"cinder-az1", "cinder-az2"},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name           string
+		ignoreVolumeAZ bool
+		controlPlane   *types.MachinePool
+		compute        []types.MachinePool
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name:           "true",
+			ignoreVolumeAZ: true,
+			expectedConfig: `[BlockStorage]
+ignore-volume-az = true
+`,
+		},
+		{
+			name:         "false is omitted",
+			controlPlane: zonedPool,
+		},
+		{
+			name:           "conflict with the control plane root volumes",
+			ignoreVolumeAZ: true,
+			controlPlane:   zonedPool,
+			expectedError:  "invalid ignore-volume-az: conflicts with the root volume availability zones cinder-az1, cinder-az2",
+		},
+		{
+			name:           "conflict with the compute root volumes",
+			ignoreVolumeAZ: true,
+			compute:        []types.MachinePool{*zonedPool, *zonedPool},
+			expectedError:  "invalid ignore-volume-az: conflicts with the root volume availability zones cinder-az1, cinder-az2",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking:   &types.Networking{},
+				ControlPlane: tc.controlPlane,
+				Compute:      tc.compute,
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							BlockStorage: &openstack.CloudProviderBlockStorage{
+								IgnoreVolumeAZ: tc.ignoreVolumeAZ,
+							},
+						},
+					},
+				},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			if tc.expectedConfig == "" {
+				assert.NotContains(t, config, "[BlockStorage]")
+				return
+			}
+			assert.Contains(t, config, tc.expectedConfig)
+		})
+	}
+}
+
+func TestCloudProviderConfigBlockStorageAvailabilityZone(t *testing.T) {
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name             string
+		availabilityZone string
+		ignoreVolumeAZ   bool
+		expectedConfig   string
+		expectedError    string
+	}{
+		{
+			name:             "set",
+			availabilityZone: "cinder-az1",
+			expectedConfig: `[BlockStorage]
+availability-zone = "cinder-az1"
+`,
+		},
+		{
+			name: "unset",
+		},
+		{
+			name:             "blank",
+			availabilityZone: " ",
+			expectedError:    `invalid availability-zone " ": the availability zone is blank`,
+		},
+		{
+			name:             "conflict with ignore-volume-az",
+			availabilityZone: "cinder-az1",
+			ignoreVolumeAZ:   true,
+			expectedError:    "invalid availability-zone: conflicts with ignore-volume-az",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							BlockStorage: &openstack.CloudProviderBlockStorage{
+								AvailabilityZone: tc.availabilityZone,
+								IgnoreVolumeAZ:   tc.ignoreVolumeAZ,
+							},
+						},
+					},
+				},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			if tc.expectedConfig == "" {
+				assert.NotContains(t, config, "[BlockStorage]")
+				return
+			}
+			assert.Contains(t, config, tc.expectedConfig)
+		})
+	}
+}
+
+func TestCloudProviderConfigBSVersion(t *testing.T) {
+	cases := []struct {
+		bsVersion     string
+		expectedLine  string
+		expectedError string
+	}{
+		{
+			bsVersion:    "v2",
+			expectedLine: "bs-version = v2\n",
+		},
+		{
+			bsVersion:    "v3",
+			expectedLine: "bs-version = v3\n",
+		},
+		{
+			bsVersion:    "auto",
+			expectedLine: "bs-version = auto\n",
+		},
+		{
+			bsVersion:     "v1",
+			expectedError: `invalid bs-version: unsupported Cinder API version "v1", must be v2, v3 or auto`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.bsVersion, func(t *testing.T) {
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							BlockStorage: &openstack.CloudProviderBlockStorage{
+								BSVersion: tc.bsVersion,
+							},
+						},
+					},
+				},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, config, tc.expectedLine)
+		})
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+		installConfig := types.InstallConfig{
+			Networking: &types.Networking{},
+			Platform: types.Platform{
+				OpenStack: &openstack.Platform{
+					CloudProviderConfig: &openstack.CloudProviderConfig{
+						BlockStorage: &openstack.CloudProviderBlockStorage{},
+					},
+				},
+			},
+		}
+
+		config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+		assert.NoError(t, err)
+		assert.NotContains(t, config, "bs-version")
+	})
+}
+
+func TestCloudProviderConfigTrustDevicePath(t *testing.T) {
+	cases := []struct {
+		name            string
+		trustDevicePath bool
+		expectedConfig  string
+	}{
+		{
+			name:            "true",
+			trustDevicePath: true,
+			expectedConfig: `[BlockStorage]
+trust-device-path = true
+`,
+		},
+		{
+			name: "unset",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							BlockStorage: &openstack.CloudProviderBlockStorage{
+								TrustDevicePath: tc.trustDevicePath,
+							},
+						},
+					},
+				},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			if tc.expectedConfig == "" {
+				assert.NotContains(t, config, "trust-device-path")
+				return
+			}
+			assert.Contains(t, config, tc.expectedConfig)
+		})
+	}
+}
+
+func TestCloudProviderConfigNodeVolumeAttachLimit(t *testing.T) {
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name           string
+		configLimit    *int
+		poolLimit      *int
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name:          "zero",
+			configLimit:   pointer.Int(0),
+			expectedError: "invalid node-volume-attach-limit: 0 is not between 1 and 256",
+		},
+		{
+			name:        "minimum",
+			configLimit: pointer.Int(1),
+			expectedConfig: `[BlockStorage]
+node-volume-attach-limit = 1
+`,
+		},
+		{
+			name:        "maximum",
+			configLimit: pointer.Int(256),
+			expectedConfig: `[BlockStorage]
+node-volume-attach-limit = 256
+`,
+		},
+		{
+			name:          "above the maximum",
+			configLimit:   pointer.Int(257),
+			expectedError: "invalid node-volume-attach-limit: 257 is not between 1 and 256",
+		},
+		{
+			name:      "from the default machine platform",
+			poolLimit: pointer.Int(256),
+			expectedConfig: `[BlockStorage]
+node-volume-attach-limit = 256
+`,
+		},
+		{
+			name:          "out of range on the default machine platform",
+			poolLimit:     pointer.Int(0),
+			expectedError: "invalid node-volume-attach-limit: 0 is not between 1 and 256",
+		},
+		{
+			name:        "same limit in both",
+			configLimit: pointer.Int(25),
+			poolLimit:   pointer.Int(25),
+			expectedConfig: `[BlockStorage]
+node-volume-attach-limit = 25
+`,
+		},
+		{
+			name:          "conflicting limits",
+			configLimit:   pointer.Int(25),
+			poolLimit:     pointer.Int(26),
+			expectedError: "invalid node-volume-attach-limit: 25 conflicts with the limit 26 of the default machine platform",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			platform := &openstack.Platform{
+				DefaultMachinePlatform: &openstack.MachinePool{
+					NodeVolumeAttachLimit: tc.poolLimit,
+				},
+			}
+			if tc.configLimit != nil {
+				platform.CloudProviderConfig = &openstack.CloudProviderConfig{
+					BlockStorage: &openstack.CloudProviderBlockStorage{
+						NodeVolumeAttachLimit: tc.configLimit,
+					},
+				}
+			}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform:   types.Platform{OpenStack: platform},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Contains(t, config, tc.expectedConfig)
+		})
+	}
+}
+
+func TestCloudProviderConfigLogging(t *testing.T) {
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.DebugLevel)
+	t.Cleanup(func() { logrus.SetLevel(level) })
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				CloudProviderConfig: &openstack.CloudProviderConfig{
+					Metadata: &openstack.CloudProviderMetadata{
+						SearchOrder: "configDrive",
+					},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name             string
+		authInfo         *clientconfig.AuthInfo
+		expectedRedacted string
+	}{
+		{
+			name: "password",
+			authInfo: &clientconfig.AuthInfo{
+				Username: "my_user",
+				Password: "my_secret",
+			},
+			expectedRedacted: "password = <redacted>",
+		},
+		{
+			name: "application credential",
+			authInfo: &clientconfig.AuthInfo{
+				ApplicationCredentialID:     "my_app_cred_id",
+				ApplicationCredentialSecret: "my_secret",
+			},
+			expectedRedacted: "application-credential-secret = <redacted>",
+		},
+		{
+			name: "token",
+			authInfo: &clientconfig.AuthInfo{
+				Token: "my_secret",
+			},
+			expectedRedacted: "token-id = <redacted>",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := logrusTest.NewGlobal()
+			t.Cleanup(hook.Reset)
+
+			cloud := clientconfig.Cloud{AuthInfo: tc.authInfo}
+			_, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), WithInlineCredentials())
+			assert.NoError(t, err)
+
+			var lines []string
+			for _, entry := range hook.AllEntries() {
+				line, err := entry.String()
+				assert.NoError(t, err)
+				assert.NotContains(t, line, "my_secret")
+				lines = append(lines, line)
+			}
+			logs := strings.Join(lines, "")
+			assert.Contains(t, logs, tc.expectedRedacted)
+			assert.Contains(t, logs, "No external network configured")
+			assert.Contains(t, logs, `msg="Skipping cloud provider config section: no setting configured" section=LoadBalancer`)
+			assert.Contains(t, logs, `msg="Writing cloud provider config section" section=Metadata settings="search-order = configDrive"`)
+		})
+	}
+}
+
+func TestCloudProviderConfigHeader(t *testing.T) {
+	cloud := clientconfig.Cloud{
+		AuthInfo:   &clientconfig.AuthInfo{},
+		RegionName: "my_region",
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{},
+		},
+	}
+
+	cases := []struct {
+		name           string
+		opts           []Option
+		expectedConfig string
+	}{
+		{
+			name: "header off",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+region = "my_region"
+`,
+		},
+		{
+			name: "header on",
+			opts: []Option{WithHeader("Generated by openshift-install v4.14.0", "", "cloud: openstack\ntimestamp: 2023-09-01T00:00:00Z")},
+			expectedConfig: `# Generated by openshift-install v4.14.0
+#
+# cloud: openstack
+# timestamp: 2023-09-01T00:00:00Z
+
+[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+region = "my_region"
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), tc.opts...)
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, config, "unexpected cloud provider config")
+
+			parsed, err := ParseCloudProviderConfig([]byte(config))
+			assert.NoError(t, err, "failed to parse cloud provider config")
+			assert.Equal(t, "my_region", parsed.Global.Region)
+		})
+	}
+}
+
+func TestCloudProviderConfigClusterAPI(t *testing.T) {
+	caCertFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caCertFile, []byte(testCACert), 0o600)
+	assert.NoError(t, err)
+
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			DomainName: "Default",
+		},
+		RegionName: "my_region",
+		CACertFile: caCertFile,
+	}
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				CloudProviderConfig: &openstack.CloudProviderConfig{
+					LoadBalancer: &openstack.CloudProviderLoadBalancer{
+						Provider: "ovn",
+					},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name           string
+		opts           []Option
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name: "default",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+domain-name = "Default"
+region = "my_region"
+ca-file = "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem"
+
+[LoadBalancer]
+lb-provider = ovn
+`,
+		},
+		{
+			name: "cluster api",
+			opts: []Option{WithClusterAPI()},
+			expectedConfig: `[Global]
+region = "my_region"
+ca-file = "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem"
+
+[LoadBalancer]
+lb-provider = ovn
+`,
+		},
+		{
+			name:          "cluster api with inline credentials",
+			opts:          []Option{WithClusterAPI(), WithInlineCredentials()},
+			expectedError: "invalid Cluster API mode: conflicts with the inline credentials",
+		},
+		{
+			name:          "cluster api with clouds file",
+			opts:          []Option{WithClusterAPI(), WithCloudsFile("/etc/openstack/clouds.yaml", "openstack")},
+			expectedError: "invalid Cluster API mode: conflicts with the clouds file /etc/openstack/clouds.yaml",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, _, err := generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig), tc.opts...)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, config, "unexpected cloud provider config")
 		})
 	}
 }
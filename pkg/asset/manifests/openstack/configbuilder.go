@@ -0,0 +1,230 @@
+package openstack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// sectionOrder is the canonical order of the sections of the cloud provider
+// config: Global, Networking, LoadBalancer, BlockStorage, Metadata and Route.
+// Sections are always written in this order, whichever settings are set, so
+// that the generated config only changes where its settings do.
+var sectionOrder = []string{"Global", "Networking", "LoadBalancer", "BlockStorage", "Metadata", "Route"}
+
+// secretKeys are the settings whose values are never logged.
+var secretKeys = map[string]bool{
+	"password":                      true,
+	"application-credential-secret": true,
+	"token-id":                      true,
+}
+
+// ConfigBuilder accumulates the settings of a cloud provider config and renders
+// them in the gcfg syntax read by the cloud provider. The sections are rendered
+// in the canonical order whichever order they are filled in, their settings in
+// the order they are set, and the empty sections are left out.
+type ConfigBuilder struct {
+	header   []string
+	sections map[string]*SectionBuilder
+}
+
+// SectionBuilder accumulates the settings of a section of a cloud provider
+// config.
+type SectionBuilder struct {
+	settings []setting
+}
+
+// setting is a key of a section and its value, as written to the config.
+type setting struct {
+	key   string
+	value string
+	// quoted is set for the values that are quoted when written, which
+	// makes any value safe to write.
+	quoted bool
+}
+
+// NewConfigBuilder returns an empty ConfigBuilder.
+func NewConfigBuilder() *ConfigBuilder {
+	return &ConfigBuilder{sections: make(map[string]*SectionBuilder)}
+}
+
+// Header sets the lines of the comment written at the top of the config.
+func (b *ConfigBuilder) Header(lines ...string) *ConfigBuilder {
+	b.header = lines
+	return b
+}
+
+// Global returns the [Global] section of the config.
+func (b *ConfigBuilder) Global() *SectionBuilder { return b.section("Global") }
+
+// Networking returns the [Networking] section of the config.
+func (b *ConfigBuilder) Networking() *SectionBuilder { return b.section("Networking") }
+
+// LoadBalancer returns the [LoadBalancer] section of the config.
+func (b *ConfigBuilder) LoadBalancer() *SectionBuilder { return b.section("LoadBalancer") }
+
+// BlockStorage returns the [BlockStorage] section of the config.
+func (b *ConfigBuilder) BlockStorage() *SectionBuilder { return b.section("BlockStorage") }
+
+// Metadata returns the [Metadata] section of the config.
+func (b *ConfigBuilder) Metadata() *SectionBuilder { return b.section("Metadata") }
+
+// Route returns the [Route] section of the config.
+func (b *ConfigBuilder) Route() *SectionBuilder { return b.section("Route") }
+
+func (b *ConfigBuilder) section(name string) *SectionBuilder {
+	section, ok := b.sections[name]
+	if !ok {
+		section = new(SectionBuilder)
+		b.sections[name] = section
+	}
+	return section
+}
+
+// Build renders the config. It fails when a value set unquoted can't be read
+// back verbatim by gcfg.
+func (b *ConfigBuilder) Build() ([]byte, error) {
+	var res bytes.Buffer
+	if _, err := b.WriteTo(&res); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+// WriteTo renders the config to w, writing each section as soon as it is
+// rendered. Like Build, it fails when a value set unquoted can't be read back
+// verbatim by gcfg: the sections are all rendered so that every such value is
+// reported, but nothing is written past the first failure, so w may then hold
+// the beginning of the config.
+func (b *ConfigBuilder) WriteTo(w io.Writer) (int64, error) {
+	var header strings.Builder
+	for _, line := range b.header {
+		// A line break in a header line would end the comment.
+		for _, comment := range strings.Split(line, "\n") {
+			header.WriteString(strings.TrimRight("# "+comment, " ") + "\n")
+		}
+	}
+	var written int64
+	if header.Len() > 0 {
+		n, err := io.WriteString(w, header.String())
+		written += int64(n)
+		if err != nil {
+			return written, Error{err, "failed to write cloud provider config"}
+		}
+	}
+
+	var errs Errors
+	for _, name := range sectionOrder {
+		section := b.sections[name]
+		if section.Len() == 0 {
+			logrus.WithField("section", name).Debug("Skipping cloud provider config section: no setting configured")
+			continue
+		}
+		body, err := section.render()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(errs) > 0 {
+			continue
+		}
+		logrus.WithFields(logrus.Fields{
+			"section":  name,
+			"settings": redactSettings(body),
+		}).Debug("Writing cloud provider config section")
+		text := "[" + name + "]\n" + body
+		if written > 0 {
+			text = "\n" + text
+		}
+		n, err := io.WriteString(w, text)
+		written += int64(n)
+		if err != nil {
+			return written, Error{err, "failed to write cloud provider config"}
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return written, nil
+	case 1:
+		return written, errs[0]
+	default:
+		return written, errs
+	}
+}
+
+// Set sets the given key to the given value, written as is. It is meant for
+// the values that never need quoting, such as IDs and enumerated values.
+func (s *SectionBuilder) Set(key, value string) *SectionBuilder {
+	s.settings = append(s.settings, setting{key: key, value: value})
+	return s
+}
+
+// SetQuoted sets the given key to the given value, quoted so that gcfg reads
+// it back verbatim.
+func (s *SectionBuilder) SetQuoted(key, value string) *SectionBuilder {
+	s.settings = append(s.settings, setting{key: key, value: value, quoted: true})
+	return s
+}
+
+// SetBool sets the given key to the given boolean.
+func (s *SectionBuilder) SetBool(key string, value bool) *SectionBuilder {
+	return s.Set(key, formatBool(value))
+}
+
+// SetInt sets the given key to the given integer.
+func (s *SectionBuilder) SetInt(key string, value int) *SectionBuilder {
+	return s.Set(key, strconv.Itoa(value))
+}
+
+// Len returns the number of settings of the section. A nil section has none.
+func (s *SectionBuilder) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.settings)
+}
+
+// render returns the settings of the section, one per line.
+func (s *SectionBuilder) render() (string, error) {
+	var res strings.Builder
+	for _, setting := range s.settings {
+		value := setting.value
+		if setting.quoted {
+			value = quoteValue(value)
+		} else if value != strings.TrimSpace(value) || strings.ContainsAny(value, "\n;#\"\\") {
+			// gcfg trims the unquoted values and reads the rest of the line
+			// after a ; or a # as a comment.
+			return "", Error{fmt.Errorf("the value %q must be quoted", value), "invalid " + setting.key}
+		}
+		res.WriteString(setting.key + " = " + value + "\n")
+	}
+	return res.String(), nil
+}
+
+// formatBool returns the canonical form of a boolean in the cloud provider
+// config, lowercase true or false. gcfg also reads yes, on and 1, but every
+// boolean is written the same way so that the generated configs compare
+// equal.
+func formatBool(value bool) string {
+	if value {
+		return "true"
+	}
+	return "false"
+}
+
+// redactSettings returns the settings of a section body, one per line, with the
+// values of the secret settings replaced.
+func redactSettings(body string) string {
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		if ok && secretKeys[strings.TrimSpace(key)] {
+			lines[i] = strings.TrimSpace(key) + " = <redacted>"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,189 @@
+package openstack
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigBuilder(t *testing.T) {
+	cases := []struct {
+		name           string
+		build          func(b *ConfigBuilder)
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name:  "empty",
+			build: func(b *ConfigBuilder) {},
+		},
+		{
+			name: "canonical section order",
+			build: func(b *ConfigBuilder) {
+				b.Route().Set("router", "r")
+				b.LoadBalancer().Set("lb", "l")
+				b.Global().Set("global", "g")
+			},
+			expectedConfig: `[Global]
+global = g
+
+[LoadBalancer]
+lb = l
+
+[Route]
+router = r
+`,
+		},
+		{
+			name: "settings in the order they are set",
+			build: func(b *ConfigBuilder) {
+				b.BlockStorage().Set("b", "2").Set("a", "1")
+				b.BlockStorage().Set("b", "3")
+			},
+			expectedConfig: `[BlockStorage]
+b = 2
+a = 1
+b = 3
+`,
+		},
+		{
+			name: "empty sections left out",
+			build: func(b *ConfigBuilder) {
+				b.Global()
+				b.Metadata().Set("key", "value")
+			},
+			expectedConfig: `[Metadata]
+key = value
+`,
+		},
+		{
+			name: "typed values",
+			build: func(b *ConfigBuilder) {
+				b.Networking().
+					SetQuoted("quoted", "a \"b\"#c;d\n").
+					SetBool("enabled", true).
+					SetBool("disabled", false).
+					SetInt("count", -3)
+			},
+			expectedConfig: `[Networking]
+quoted = "a \"b\"#c;d\n"
+enabled = true
+disabled = false
+count = -3
+`,
+		},
+		{
+			name: "header",
+			build: func(b *ConfigBuilder) {
+				b.Header("first", "", "second\nthird")
+				b.Global().Set("key", "value")
+			},
+			expectedConfig: `# first
+#
+# second
+# third
+
+[Global]
+key = value
+`,
+		},
+		{
+			name: "unquoted value with a comment character",
+			build: func(b *ConfigBuilder) {
+				b.Global().Set("key", "a#b")
+			},
+			expectedError: `invalid key: the value "a#b" must be quoted`,
+		},
+		{
+			name: "unquoted values in several sections",
+			build: func(b *ConfigBuilder) {
+				b.Global().Set("padded", " value")
+				b.Route().Set("multiline", "a\nb")
+			},
+			expectedError: `invalid padded: the value " value" must be quoted
+invalid multiline: the value "a\nb" must be quoted`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := NewConfigBuilder()
+			tc.build(b)
+			config, err := b.Build()
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, string(config))
+		})
+	}
+}
+
+func TestFormatBool(t *testing.T) {
+	cases := []struct {
+		value    bool
+		expected string
+	}{
+		{value: true, expected: "true"},
+		{value: false, expected: "false"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expected, func(t *testing.T) {
+			assert.Equal(t, tc.expected, formatBool(tc.value))
+
+			b := NewConfigBuilder()
+			b.LoadBalancer().SetBool("use-octavia", tc.value)
+			b.BlockStorage().SetBool("trust-device-path", tc.value)
+			data, err := b.Build()
+			assert.NoError(t, err)
+
+			config, err := ParseCloudProviderConfig(data)
+			if assert.NoError(t, err) {
+				assert.Equal(t, &tc.value, config.LoadBalancer.UseOctavia)
+				assert.Equal(t, tc.value, config.BlockStorage.TrustDevicePath)
+			}
+		})
+	}
+}
+
+// recordingWriter records the data of every write.
+type recordingWriter struct {
+	writes []string
+}
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, string(p))
+	return len(p), nil
+}
+
+func TestConfigBuilderWriteTo(t *testing.T) {
+	b := NewConfigBuilder().Header("generated")
+	b.Global().Set("global", "g")
+	b.Route().Set("router", "r")
+
+	var w recordingWriter
+	n, err := b.WriteTo(&w)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"# generated\n", "\n[Global]\nglobal = g\n", "\n[Route]\nrouter = r\n"}, w.writes, "expected a write per section")
+	assert.EqualValues(t, len(strings.Join(w.writes, "")), n)
+
+	data, err := b.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Join(w.writes, ""), string(data))
+
+	t.Run("invalid section", func(t *testing.T) {
+		b := NewConfigBuilder()
+		b.Global().Set("global", "g")
+		b.LoadBalancer().Set("padded", " value")
+		b.Route().Set("multiline", "a\nb")
+
+		var w recordingWriter
+		_, err := b.WriteTo(&w)
+		assert.EqualError(t, err, `invalid padded: the value " value" must be quoted
+invalid multiline: the value "a\nb" must be quoted`)
+		assert.Equal(t, []string{"[Global]\nglobal = g\n"}, w.writes, "nothing must be written past the first failure")
+	})
+}
@@ -0,0 +1,190 @@
+package openstack
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parsedConfig is the normalized content of a cloud provider config: the
+// values of each key of each section, as read by ParseCloudProviderConfig.
+// Section names are lower-cased, the values of repeated keys are sorted, and
+// the settings left to their zero value are left out, since the cloud provider
+// reads them like missing ones.
+type parsedConfig map[string]map[string][]string
+
+// normalizeConfig reads a cloud provider config with ParseCloudProviderConfig,
+// so that the configs are compared as gcfg reads them.
+func normalizeConfig(data []byte) (parsedConfig, error) {
+	cloudConfig, err := ParseCloudProviderConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(parsedConfig)
+	sections := reflect.ValueOf(cloudConfig).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		sectionName := strings.ToLower(sections.Type().Field(i).Tag.Get("gcfg"))
+		section := sections.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			values := settingValues(section.Field(j))
+			if len(values) == 0 {
+				continue
+			}
+			if config[sectionName] == nil {
+				config[sectionName] = make(map[string][]string)
+			}
+			config[sectionName][section.Type().Field(j).Tag.Get("gcfg")] = values
+		}
+	}
+	return config, nil
+}
+
+// settingValues returns the values of a field of CloudConfig, formatted as
+// they are written, or nothing when the field is unset.
+func settingValues(field reflect.Value) []string {
+	switch field.Kind() {
+	case reflect.Pointer:
+		if field.IsNil() {
+			return nil
+		}
+		return []string{formatSetting(field.Elem())}
+	case reflect.Slice:
+		values := make([]string, 0, field.Len())
+		for i := 0; i < field.Len(); i++ {
+			values = append(values, formatSetting(field.Index(i)))
+		}
+		sort.Strings(values)
+		return values
+	default:
+		if field.IsZero() {
+			return nil
+		}
+		return []string{formatSetting(field)}
+	}
+}
+
+func formatSetting(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.Bool:
+		return formatBool(value.Bool())
+	case reflect.Int:
+		return strconv.FormatInt(value.Int(), 10)
+	default:
+		return value.String()
+	}
+}
+
+// DiffConfigs compares two cloud provider configs semantically, ignoring the
+// order of the sections and keys, the whitespace, the comments and the quoting
+// of the values. The configs are read by ParseCloudProviderConfig, so that
+// they compare equal exactly when gcfg reads the same settings from them. It
+// returns a description of each setting that differs, in section and key
+// order, or nothing when the configs are equivalent.
+func DiffConfigs(a, b []byte) ([]string, error) {
+	configA, err := normalizeConfig(a)
+	if err != nil {
+		return nil, err
+	}
+	configB, err := normalizeConfig(b)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := make(map[string]bool)
+	for section := range configA {
+		sections[section] = true
+	}
+	for section := range configB {
+		sections[section] = true
+	}
+	sectionNames := make([]string, 0, len(sections))
+	for section := range sections {
+		sectionNames = append(sectionNames, section)
+	}
+	sort.Strings(sectionNames)
+
+	var diff []string
+	for _, section := range sectionNames {
+		keys := make(map[string]bool)
+		for key := range configA[section] {
+			keys[key] = true
+		}
+		for key := range configB[section] {
+			keys[key] = true
+		}
+		keyNames := make([]string, 0, len(keys))
+		for key := range keys {
+			keyNames = append(keyNames, key)
+		}
+		sort.Strings(keyNames)
+
+		for _, key := range keyNames {
+			valuesA, inA := configA[section][key]
+			valuesB, inB := configB[section][key]
+			switch {
+			case !inA:
+				diff = append(diff, fmt.Sprintf("[%s] %s: added %s", section, key, formatValues(valuesB)))
+			case !inB:
+				diff = append(diff, fmt.Sprintf("[%s] %s: removed %s", section, key, formatValues(valuesA)))
+			case formatValues(valuesA) != formatValues(valuesB):
+				diff = append(diff, fmt.Sprintf("[%s] %s: %s -> %s", section, key, formatValues(valuesA), formatValues(valuesB)))
+			}
+		}
+	}
+	return diff, nil
+}
+
+// ConfigsEqual reports whether two cloud provider configs are semantically
+// equal, as defined by DiffConfigs.
+func ConfigsEqual(a, b []byte) (bool, error) {
+	diff, err := DiffConfigs(a, b)
+	if err != nil {
+		return false, err
+	}
+	return len(diff) == 0, nil
+}
+
+// ConfigChecksum returns the SHA-256 hex digest of the semantic content of a
+// cloud provider config, so that the configs ConfigsEqual reports as equal have
+// the same checksum. A config that can't be parsed is hashed as is.
+func ConfigChecksum(data []byte) string {
+	config, err := normalizeConfig(data)
+	if err != nil {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+
+	sections := make([]string, 0, len(config))
+	for section := range config {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	hash := sha256.New()
+	for _, section := range sections {
+		keys := make([]string, 0, len(config[section]))
+		for key := range config[section] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(hash, "[%s]\n", section)
+		for _, key := range keys {
+			fmt.Fprintf(hash, "%s = %s\n", key, formatValues(config[section][key]))
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func formatValues(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, strconv.Quote(value))
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,204 @@
+package openstack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	config := `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+region = "my_region"
+
+[Networking]
+public-network-name = "public"
+public-network-name = "public-v6"
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+`
+
+	cases := []struct {
+		name          string
+		other         string
+		expectedDiff  []string
+		expectedError string
+	}{
+		{
+			name:  "identical",
+			other: config,
+		},
+		{
+			name: "reordered",
+			other: `; Generated by the installer.
+[LoadBalancer]
+floating-network-id=a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+
+[networking]
+public-network-name = public-v6
+public-network-name = "public"
+
+[Global]
+  region = my_region
+secret-namespace = kube-system
+Secret-Name = openstack-credentials
+`,
+		},
+		{
+			name: "changed values",
+			other: `[Global]
+secret-name = openstack-credentials
+secret-namespace = openshift-config
+region = "my_region"
+
+[Networking]
+public-network-name = "public"
+
+[Route]
+router-id = 5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51
+`,
+			expectedDiff: []string{
+				`[global] secret-namespace: "kube-system" -> "openshift-config"`,
+				`[loadbalancer] floating-network-id: removed "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11"`,
+				`[networking] public-network-name: "public", "public-v6" -> "public"`,
+				`[route] router-id: added "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51"`,
+			},
+		},
+		{
+			name: "gcfg quoting and comments",
+			other: `[Global]
+secret-name = openstack-credentials ; the default
+secret-namespace = "kube-system" # the default
+region = my"_"region
+
+[Networking]
+public-network-name = "public"
+public-network-name = public-v6
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+`,
+		},
+		{
+			name: "blank settings",
+			other: config + `internal-lb = false
+
+[Metadata]
+search-order =
+`,
+		},
+		{
+			name:          "malformed",
+			other:         "[Global]\nregion\n",
+			expectedError: `failed to parse cloud provider config: blank value not supported for type at section "Global", variable "region"`,
+		},
+		{
+			name:          "setting outside of a section",
+			other:         "region = my_region\n",
+			expectedError: "failed to parse cloud provider config: 1:1: expected section header",
+		},
+		{
+			name:          "unknown setting",
+			other:         "[Global]\nunknown = value\n",
+			expectedError: "failed to parse cloud provider config: warning:\ncan't store data at section \"Global\", variable \"unknown\"\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff, err := DiffConfigs([]byte(config), []byte(tc.other))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDiff, diff)
+
+			equal, err := ConfigsEqual([]byte(config), []byte(tc.other))
+			assert.NoError(t, err)
+			assert.Equal(t, len(tc.expectedDiff) == 0, equal)
+		})
+	}
+}
+
+func TestConfigChecksum(t *testing.T) {
+	config := `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[Networking]
+public-network-name = "public"
+public-network-name = "public-v6"
+`
+
+	cases := []struct {
+		name          string
+		other         string
+		expectedEqual bool
+	}{
+		{
+			name: "reordered",
+			other: `[networking]
+public-network-name = public-v6
+public-network-name = "public"
+
+[Global]
+  secret-namespace = kube-system ; comment
+Secret-Name=openstack-credentials
+`,
+			expectedEqual: true,
+		},
+		{
+			name: "changed value",
+			other: `[Global]
+secret-name = openstack-credentials
+secret-namespace = openshift-config
+
+[Networking]
+public-network-name = "public"
+public-network-name = "public-v6"
+`,
+		},
+		{
+			name: "moved setting",
+			other: `[Global]
+secret-name = openstack-credentials
+
+[Networking]
+secret-namespace = kube-system
+public-network-name = "public"
+public-network-name = "public-v6"
+`,
+		},
+		{
+			name: "gcfg quoting",
+			other: `[Global]
+secret-name = "openstack-credentials"
+secret-namespace = kube"-"system
+
+[Networking]
+public-network-name = "public" ; comment
+public-network-name = public-v6
+`,
+			expectedEqual: true,
+		},
+		{
+			name:  "malformed",
+			other: "[Global]\nsecret-name\n",
+		},
+	}
+
+	checksum := ConfigChecksum([]byte(config))
+	assert.Len(t, checksum, 64)
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.expectedEqual {
+				assert.Equal(t, checksum, ConfigChecksum([]byte(tc.other)))
+			} else {
+				assert.NotEqual(t, checksum, ConfigChecksum([]byte(tc.other)))
+			}
+		})
+	}
+}
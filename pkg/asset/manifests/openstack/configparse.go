@@ -0,0 +1,190 @@
+package openstack
+
+import (
+	"strings"
+
+	"gopkg.in/gcfg.v1"
+	"gopkg.in/gcfg.v1/scanner"
+	"gopkg.in/gcfg.v1/token"
+)
+
+// redactedValue replaces the values of the secret settings in the configs
+// returned by Redact.
+const redactedValue = "REDACTED"
+
+// CloudConfig is the content of a cloud provider config, as read by the
+// OpenStack cloud provider. It holds every setting written by this package.
+type CloudConfig struct {
+	Global       GlobalConfig       `gcfg:"Global"`
+	Networking   NetworkingConfig   `gcfg:"Networking"`
+	LoadBalancer LoadBalancerConfig `gcfg:"LoadBalancer"`
+	BlockStorage BlockStorageConfig `gcfg:"BlockStorage"`
+	Metadata     MetadataConfig     `gcfg:"Metadata"`
+	Route        RouteConfig        `gcfg:"Route"`
+}
+
+// GlobalConfig holds the settings of the [Global] section, both those of the
+// system secret and those of the cloud provider config.
+type GlobalConfig struct {
+	AuthURL                     string `gcfg:"auth-url"`
+	UserID                      string `gcfg:"user-id"`
+	Username                    string `gcfg:"username"`
+	Password                    string `gcfg:"password"`
+	ApplicationCredentialID     string `gcfg:"application-credential-id"`
+	ApplicationCredentialName   string `gcfg:"application-credential-name"`
+	ApplicationCredentialSecret string `gcfg:"application-credential-secret"`
+	TokenID                     string `gcfg:"token-id"`
+	TokenFile                   string `gcfg:"token-file"`
+	TrustID                     string `gcfg:"trust-id"`
+	TenantID                    string `gcfg:"tenant-id"`
+	TenantName                  string `gcfg:"tenant-name"`
+	ProjectID                   string `gcfg:"project-id"`
+	ProjectName                 string `gcfg:"project-name"`
+	DomainID                    string `gcfg:"domain-id"`
+	DomainName                  string `gcfg:"domain-name"`
+	UserDomainID                string `gcfg:"user-domain-id"`
+	UserDomainName              string `gcfg:"user-domain-name"`
+	ProjectDomainID             string `gcfg:"project-domain-id"`
+	ProjectDomainName           string `gcfg:"project-domain-name"`
+	Region                      string `gcfg:"region"`
+	CAFile                      string `gcfg:"ca-file"`
+	TLSInsecure                 bool   `gcfg:"tls-insecure"`
+	SecretName                  string `gcfg:"secret-name"`
+	SecretNamespace             string `gcfg:"secret-namespace"`
+	UseClouds                   bool   `gcfg:"use-clouds"`
+	CloudsFile                  string `gcfg:"clouds-file"`
+	Cloud                       string `gcfg:"cloud"`
+	EndpointType                string `gcfg:"os-endpoint-type"`
+	IdentityAPIVersion          string `gcfg:"identity-api-version"`
+}
+
+// NetworkingConfig holds the settings of the [Networking] section.
+type NetworkingConfig struct {
+	PublicNetworkNames   []string `gcfg:"public-network-name"`
+	InternalNetworkNames []string `gcfg:"internal-network-name"`
+	IPv6SupportDisabled  *bool    `gcfg:"ipv6-support-disabled"`
+	AddressSortOrder     string   `gcfg:"address-sort-order"`
+}
+
+// LoadBalancerConfig holds the settings of the [LoadBalancer] section.
+type LoadBalancerConfig struct {
+	Enabled               *bool  `gcfg:"enabled"`
+	FloatingNetworkID     string `gcfg:"floating-network-id"`
+	FloatingSubnetID      string `gcfg:"floating-subnet-id"`
+	SubnetID              string `gcfg:"subnet-id"`
+	UseOctavia            *bool  `gcfg:"use-octavia"`
+	LBProvider            string `gcfg:"lb-provider"`
+	LBMethod              string `gcfg:"lb-method"`
+	InternalLB            bool   `gcfg:"internal-lb"`
+	ManageSecurityGroups  *bool  `gcfg:"manage-security-groups"`
+	EnableIngressHostname bool   `gcfg:"enable-ingress-hostname"`
+	IngressHostnameSuffix string `gcfg:"ingress-hostname-suffix"`
+	MaxSharedLB           *int   `gcfg:"max-shared-lb"`
+	CreateMonitor         *bool  `gcfg:"create-monitor"`
+	MonitorDelay          string `gcfg:"monitor-delay"`
+	MonitorTimeout        string `gcfg:"monitor-timeout"`
+	MonitorMaxRetries     *int   `gcfg:"monitor-max-retries"`
+}
+
+// BlockStorageConfig holds the settings of the [BlockStorage] section.
+type BlockStorageConfig struct {
+	BSVersion             string `gcfg:"bs-version"`
+	IgnoreVolumeAZ        bool   `gcfg:"ignore-volume-az"`
+	AvailabilityZone      string `gcfg:"availability-zone"`
+	TrustDevicePath       bool   `gcfg:"trust-device-path"`
+	NodeVolumeAttachLimit *int   `gcfg:"node-volume-attach-limit"`
+}
+
+// MetadataConfig holds the settings of the [Metadata] section.
+type MetadataConfig struct {
+	SearchOrder    string `gcfg:"search-order"`
+	RequestTimeout string `gcfg:"request-timeout"`
+}
+
+// RouteConfig holds the settings of the [Route] section.
+type RouteConfig struct {
+	RouterID string `gcfg:"router-id"`
+}
+
+// ParseCloudProviderConfig reads back a cloud provider config or a system
+// secret generated by this package, with the same gcfg parser as the cloud
+// provider. Unknown sections and settings are errors. The multi-cloud secrets
+// written by CloudProviderConfigSecretMulti can't be parsed.
+func ParseCloudProviderConfig(data []byte) (*CloudConfig, error) {
+	var config CloudConfig
+	if err := gcfg.ReadStringInto(&config, string(data)); err != nil {
+		return nil, Error{err, "failed to parse cloud provider config"}
+	}
+	return &config, nil
+}
+
+// Redact returns the given cloud provider config or system secret with the
+// values of its secret settings, such as the password, replaced by REDACTED,
+// for the support bundles. Everything else, comments and layout included, is
+// left untouched. The settings are found with the tokenizer of the parser of
+// ParseCloudProviderConfig, so that a value is masked whichever way it is
+// quoted. Configs the tokenizer rejects are redacted line by line instead.
+func Redact(data []byte) []byte {
+	type span struct{ start, end int }
+	var secrets []span
+	failed := false
+
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(data))
+	var s scanner.Scanner
+	s.Init(file, data, func(token.Position, string) { failed = true }, scanner.ScanComments)
+	var key string
+	var valueStart int
+	for prev := token.EOL; prev != token.EOF; {
+		pos, tok, lit := s.Scan()
+		switch {
+		case tok == token.IDENT && prev == token.EOL:
+			key = lit
+		case tok == token.ASSIGN && prev == token.IDENT:
+		case tok == token.STRING && prev == token.ASSIGN:
+			valueStart = file.Offset(pos)
+		case prev == token.STRING && (tok == token.EOL || tok == token.COMMENT || tok == token.EOF):
+			// The value ends where its line, its comment or the config
+			// ends, less the whitespace gcfg trims.
+			end := file.Offset(pos)
+			for end > valueStart && strings.ContainsRune(" \t\r", rune(data[end-1])) {
+				end--
+			}
+			if secretKeys[strings.ToLower(key)] {
+				secrets = append(secrets, span{valueStart, end})
+			}
+			key = ""
+		default:
+			key = ""
+		}
+		prev = tok
+	}
+	if failed {
+		return redactLines(data)
+	}
+
+	res := make([]byte, 0, len(data))
+	last := 0
+	for _, secret := range secrets {
+		res = append(res, data[last:secret.start]...)
+		res = append(res, redactedValue...)
+		last = secret.end
+	}
+	return append(res, data[last:]...)
+}
+
+// redactLines returns the given config with the value of every line setting a
+// secret replaced, for the configs the tokenizer of gcfg rejects.
+func redactLines(data []byte) []byte {
+	lines := strings.SplitAfter(string(data), "\n")
+	for i, line := range lines {
+		key, _, ok := strings.Cut(line, "=")
+		if ok && secretKeys[strings.ToLower(strings.TrimSpace(key))] {
+			lines[i] = key + "= " + redactedValue
+			if strings.HasSuffix(line, "\n") {
+				lines[i] += "\n"
+			}
+		}
+	}
+	return []byte(strings.Join(lines, ""))
+}
@@ -0,0 +1,270 @@
+package openstack
+
+import (
+	"testing"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/pointer"
+)
+
+func TestParseCloudProviderConfig(t *testing.T) {
+	data := `[Global]
+auth-url = "https://my_auth_url.com/v3/"
+user-id = "my_user_id"
+username = "my_user"
+password = "my \"secret\" password#1"
+application-credential-id = "my_app_cred_id"
+application-credential-name = "my_app_cred"
+application-credential-secret = "my_app_cred_secret"
+token-id = "my_token"
+trust-id = "my_trust"
+tenant-id = "my_tenant_id"
+tenant-name = "my_tenant"
+project-id = "my_project_id"
+project-name = "my_project"
+domain-id = "default"
+domain-name = "Default"
+user-domain-id = "my_user_domain_id"
+user-domain-name = "my_user_domain"
+project-domain-id = "my_project_domain_id"
+project-domain-name = "my_project_domain"
+region = "my_region"
+ca-file = "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem"
+tls-insecure = "true"
+secret-name = openstack-credentials
+secret-namespace = kube-system
+use-clouds = true
+clouds-file = "/etc/openstack/clouds.yaml"
+cloud = "openstack"
+os-endpoint-type = internal
+
+[Networking]
+public-network-name = "public"
+public-network-name = "public-v6"
+internal-network-name = "private"
+ipv6-support-disabled = true
+address-sort-order = "192.168.0.0/16"
+
+[LoadBalancer]
+enabled = true
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+floating-subnet-id = 7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61
+subnet-id = 3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10
+use-octavia = true
+lb-provider = amphora
+lb-method = LEAST_CONNECTIONS
+internal-lb = true
+manage-security-groups = false
+enable-ingress-hostname = true
+ingress-hostname-suffix = example.com
+max-shared-lb = 4
+create-monitor = true
+monitor-delay = 5s
+monitor-timeout = 3s
+monitor-max-retries = 1
+
+[BlockStorage]
+bs-version = v3
+ignore-volume-az = true
+availability-zone = "cinder-az1"
+trust-device-path = true
+node-volume-attach-limit = 25
+
+[Metadata]
+search-order = configDrive,metadataService
+request-timeout = 10s
+
+[Route]
+router-id = 5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51
+`
+
+	expected := &CloudConfig{
+		Global: GlobalConfig{
+			AuthURL:                     "https://my_auth_url.com/v3/",
+			UserID:                      "my_user_id",
+			Username:                    "my_user",
+			Password:                    `my "secret" password#1`,
+			ApplicationCredentialID:     "my_app_cred_id",
+			ApplicationCredentialName:   "my_app_cred",
+			ApplicationCredentialSecret: "my_app_cred_secret",
+			TokenID:                     "my_token",
+			TrustID:                     "my_trust",
+			TenantID:                    "my_tenant_id",
+			TenantName:                  "my_tenant",
+			ProjectID:                   "my_project_id",
+			ProjectName:                 "my_project",
+			DomainID:                    "default",
+			DomainName:                  "Default",
+			UserDomainID:                "my_user_domain_id",
+			UserDomainName:              "my_user_domain",
+			ProjectDomainID:             "my_project_domain_id",
+			ProjectDomainName:           "my_project_domain",
+			Region:                      "my_region",
+			CAFile:                      "/etc/kubernetes/static-pod-resources/configmaps/cloud-config/ca-bundle.pem",
+			TLSInsecure:                 true,
+			SecretName:                  "openstack-credentials",
+			SecretNamespace:             "kube-system",
+			UseClouds:                   true,
+			CloudsFile:                  "/etc/openstack/clouds.yaml",
+			Cloud:                       "openstack",
+			EndpointType:                "internal",
+		},
+		Networking: NetworkingConfig{
+			PublicNetworkNames:   []string{"public", "public-v6"},
+			InternalNetworkNames: []string{"private"},
+			IPv6SupportDisabled:  pointer.Bool(true),
+			AddressSortOrder:     "192.168.0.0/16",
+		},
+		LoadBalancer: LoadBalancerConfig{
+			Enabled:               pointer.Bool(true),
+			FloatingNetworkID:     "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+			FloatingSubnetID:      "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61",
+			SubnetID:              "3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10",
+			UseOctavia:            pointer.Bool(true),
+			LBProvider:            "amphora",
+			LBMethod:              "LEAST_CONNECTIONS",
+			InternalLB:            true,
+			ManageSecurityGroups:  pointer.Bool(false),
+			EnableIngressHostname: true,
+			IngressHostnameSuffix: "example.com",
+			MaxSharedLB:           pointer.Int(4),
+			CreateMonitor:         pointer.Bool(true),
+			MonitorDelay:          "5s",
+			MonitorTimeout:        "3s",
+			MonitorMaxRetries:     pointer.Int(1),
+		},
+		BlockStorage: BlockStorageConfig{
+			BSVersion:             "v3",
+			IgnoreVolumeAZ:        true,
+			AvailabilityZone:      "cinder-az1",
+			TrustDevicePath:       true,
+			NodeVolumeAttachLimit: pointer.Int(25),
+		},
+		Metadata: MetadataConfig{
+			SearchOrder:    "configDrive,metadataService",
+			RequestTimeout: "10s",
+		},
+		Route: RouteConfig{
+			RouterID: "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51",
+		},
+	}
+
+	config, err := ParseCloudProviderConfig([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, config)
+}
+
+func TestParseCloudProviderConfigErrors(t *testing.T) {
+	cases := []struct {
+		name          string
+		data          string
+		expectedError string
+	}{
+		{
+			name:          "unknown setting",
+			data:          "[Global]\nunknown = true\n",
+			expectedError: `can't store data at section "Global", variable "unknown"`,
+		},
+		{
+			name:          "invalid integer",
+			data:          "[BlockStorage]\nnode-volume-attach-limit = many\n",
+			expectedError: "failed to parse cloud provider config",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseCloudProviderConfig([]byte(tc.data))
+			assert.ErrorContains(t, err, tc.expectedError)
+		})
+	}
+}
+
+func TestRedact(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			name: "secret settings",
+			data: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my \"secret\" password#1"
+application-credential-secret = my_app_cred_secret
+token-id = "my_token"
+region = "my_region"
+`,
+			expected: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = REDACTED
+application-credential-secret = REDACTED
+token-id = REDACTED
+region = "my_region"
+`,
+		},
+		{
+			name: "layout and comments",
+			data: `# generated by the installer
+
+[Global "primary"]
+	Password="my_secret" ; rotated yearly
+secret-name = openstack-credentials # not a secret
+password =
+[Global "secondary"]
+token-id = my_token`,
+			expected: `# generated by the installer
+
+[Global "primary"]
+	Password=REDACTED ; rotated yearly
+secret-name = openstack-credentials # not a secret
+password =REDACTED
+[Global "secondary"]
+token-id = REDACTED`,
+		},
+		{
+			name:     "no secret",
+			data:     "[LoadBalancer]\nlb-provider = amphora\n",
+			expected: "[LoadBalancer]\nlb-provider = amphora\n",
+		},
+		{
+			name:     "invalid config",
+			data:     "[Global]\npassword = \"my_secret\nusername = my_user\n",
+			expected: "[Global]\npassword = REDACTED\nusername = my_user\n",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, string(Redact([]byte(tc.data))))
+		})
+	}
+}
+
+func TestRedactSecret(t *testing.T) {
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://my_auth_url.com/v3/",
+			Username: "my_user",
+			Password: `my "secret" password#1`,
+		},
+		RegionName: "my_region",
+	}
+	secret, err := CloudProviderConfigSecret(&cloud)
+	assert.NoError(t, err)
+
+	redacted := Redact(secret)
+	assert.NotContains(t, string(redacted), "secret")
+	config, err := ParseCloudProviderConfig(redacted)
+	if assert.NoError(t, err) {
+		assert.Equal(t, GlobalConfig{
+			AuthURL:  "https://my_auth_url.com/v3",
+			Username: "my_user",
+			Password: "REDACTED",
+			Region:   "my_region",
+		}, config.Global)
+	}
+}
@@ -0,0 +1,19 @@
+package openstack
+
+import (
+	"errors"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+// ManilaConfigSecret generates the config of the Manila CSI driver for the
+// given cloud, which lets the cluster provision shared filesystems. The driver
+// authenticates like the cloud provider, so the config holds the same Global
+// section as the system secret, with the V2 key names the driver reads the
+// project from. The driver doesn't need any other section.
+func ManilaConfigSecret(cloud *clientconfig.Cloud) ([]byte, error) {
+	if cloud == nil || cloud.AuthInfo == nil {
+		return nil, Error{errors.New("the cloud has no authentication settings"), "failed to generate Manila config"}
+	}
+	return CloudProviderConfigSecret(cloud, WithCCMVersion(V2))
+}
@@ -0,0 +1,74 @@
+package openstack
+
+import (
+	"testing"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManilaConfigSecret(t *testing.T) {
+	cases := []struct {
+		name           string
+		authInfo       *clientconfig.AuthInfo
+		expectedConfig string
+	}{
+		{
+			name: "password",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:     "https://my_auth_url.com/v3/",
+				Username:    "my_user",
+				Password:    "my_secret_password",
+				ProjectID:   "f12f928576ae4d21bdb984da5dd1d3bf",
+				ProjectName: "my_project",
+				DomainName:  "Default",
+			},
+			expectedConfig: `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+project-id = "f12f928576ae4d21bdb984da5dd1d3bf"
+domain-name = "Default"
+region = "my_region"
+`,
+		},
+		{
+			name: "application credential",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3/",
+				ApplicationCredentialID:     "my_app_cred_id",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   tc.authInfo,
+				RegionName: "my_region",
+			}
+
+			manilaConfig, err := ManilaConfigSecret(&cloud)
+			assert.NoError(t, err, "failed to create Manila config")
+			if tc.expectedConfig != "" {
+				assert.Equal(t, tc.expectedConfig, string(manilaConfig), "unexpected Manila config")
+			}
+			manila, err := ParseCloudProviderConfig(manilaConfig)
+			assert.NoError(t, err, "failed to parse Manila config")
+
+			ccmConfig, err := CloudProviderConfigSecret(&cloud, WithCCMVersion(V2))
+			assert.NoError(t, err, "failed to create cloud provider config")
+			ccm, err := ParseCloudProviderConfig(ccmConfig)
+			assert.NoError(t, err, "failed to parse cloud provider config")
+
+			assert.Equal(t, ccm.Global, manila.Global)
+			assert.Equal(t, "my_region", manila.Global.Region)
+		})
+	}
+
+	t.Run("no auth", func(t *testing.T) {
+		_, err := ManilaConfigSecret(&clientconfig.Cloud{})
+		assert.EqualError(t, err, "failed to generate Manila config: the cloud has no authentication settings")
+	})
+}
@@ -0,0 +1,468 @@
+package openstack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/identity/v3/regions"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/external"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/extensions/layer3/routers"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/networks"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/subnets"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+// networkResolver resolves the Neutron resources referenced by the cloud
+// provider config, and the Keystone regions it can be pinned to.
+type networkResolver interface {
+	// IDFromName returns the ID of the network with the given name.
+	IDFromName(ctx context.Context, name string) (string, error)
+
+	// NetworkName returns the name of the network with the given ID.
+	NetworkName(ctx context.Context, networkID string) (string, error)
+
+	// IsExternal reports whether the network with the given ID is external,
+	// that is whether floating IPs can be allocated from it.
+	IsExternal(ctx context.Context, networkID string) (bool, error)
+
+	// SubnetIDFromName returns the ID of the subnet of the given network
+	// that matches the given name or ID. Subnets of any network match when
+	// the network ID is empty.
+	SubnetIDFromName(ctx context.Context, networkID, name string) (string, error)
+
+	// SubnetIDFromCIDR returns the ID of the subnet of the given network
+	// with the given CIDR.
+	SubnetIDFromCIDR(ctx context.Context, networkID, cidr string) (string, error)
+
+	// SubnetIDFromTag returns the ID of the subnet of the given network
+	// with the given tag.
+	SubnetIDFromTag(ctx context.Context, networkID, tag string) (string, error)
+
+	// SubnetNetworkID returns the ID of the network the subnet with the
+	// given ID belongs to.
+	SubnetNetworkID(ctx context.Context, subnetID string) (string, error)
+
+	// RouterIDFromName returns the ID of the router that matches the given
+	// name or ID.
+	RouterIDFromName(ctx context.Context, name string) (string, error)
+
+	// RegionIDs returns the IDs of the Keystone regions of the cloud.
+	RegionIDs(ctx context.Context) ([]string, error)
+}
+
+// neutronResolver is the networkResolver backed by a gophercloud network
+// client. It remembers the networks it resolved for the rest of the installer
+// run, see networkIDCacheFor.
+type neutronResolver struct {
+	client     *gophercloud.ServiceClient
+	networkIDs *networkIDCache
+}
+
+// newNeutronResolver returns a neutronResolver for the given client, which
+// authenticates with the credentials of the given cloud. The resolver shares
+// its cache with the other resolvers of the installer run for the same Neutron
+// endpoint and credentials, so that the assets generated from the same install
+// config don't look up the same networks again.
+func newNeutronResolver(client *gophercloud.ServiceClient, cloud *clientconfig.Cloud) neutronResolver {
+	return neutronResolver{client: client, networkIDs: networkIDCacheFor(client.Endpoint, cloud)}
+}
+
+func (r neutronResolver) IDFromName(ctx context.Context, name string) (string, error) {
+	return r.networkIDs.IDFromName(ctx, r.client, name)
+}
+
+func (r neutronResolver) NetworkName(ctx context.Context, networkID string) (string, error) {
+	return networkName(withContext(ctx, r.client), networkID)
+}
+
+func (r neutronResolver) IsExternal(ctx context.Context, networkID string) (bool, error) {
+	return isExternal(withContext(ctx, r.client), networkID)
+}
+
+func (r neutronResolver) SubnetIDFromName(ctx context.Context, networkID, name string) (string, error) {
+	return subnetIDFromName(withContext(ctx, r.client), networkID, name)
+}
+
+func (r neutronResolver) SubnetIDFromCIDR(ctx context.Context, networkID, cidr string) (string, error) {
+	return subnetIDFromCIDR(withContext(ctx, r.client), networkID, cidr)
+}
+
+func (r neutronResolver) SubnetIDFromTag(ctx context.Context, networkID, tag string) (string, error) {
+	return subnetIDFromTag(withContext(ctx, r.client), networkID, tag)
+}
+
+func (r neutronResolver) SubnetNetworkID(ctx context.Context, subnetID string) (string, error) {
+	return subnetNetworkID(withContext(ctx, r.client), subnetID)
+}
+
+func (r neutronResolver) RouterIDFromName(ctx context.Context, name string) (string, error) {
+	return routerIDFromName(withContext(ctx, r.client), name)
+}
+
+func (r neutronResolver) RegionIDs(ctx context.Context) ([]string, error) {
+	return regionIDs(withContext(ctx, r.client))
+}
+
+// withContext returns a copy of the given client whose requests are bound to
+// ctx. The provider client is copied by value: the copy starts from the
+// current token of the original and shares its locks, but a token renewed by
+// the copy when it reauthenticates is not seen by the original, which is left
+// untouched.
+func withContext(ctx context.Context, client *gophercloud.ServiceClient) *gophercloud.ServiceClient {
+	provider := *client.ProviderClient
+	provider.Context = ctx
+	clientWithContext := *client
+	clientWithContext.ProviderClient = &provider
+	return &clientWithContext
+}
+
+// networkIDCache resolves network names to IDs, remembering successful
+// lookups, so that a network referenced several times is only looked up once.
+// A cache is only meant to be used with a single Neutron endpoint and set of
+// credentials.
+type networkIDCache struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func newNetworkIDCache() *networkIDCache {
+	return &networkIDCache{ids: make(map[string]string)}
+}
+
+// networkIDCacheKey identifies the Neutron endpoint and the credentials the
+// IDs of a networkIDCache were resolved with. The credentials are hashed, so
+// that the secrets they hold aren't kept around in the keys.
+type networkIDCacheKey struct {
+	endpoint    string
+	credentials [sha256.Size]byte
+}
+
+// networkIDCaches holds the network ID caches of the installer run.
+var networkIDCaches = struct {
+	mu     sync.Mutex
+	caches map[networkIDCacheKey]*networkIDCache
+}{caches: make(map[networkIDCacheKey]*networkIDCache)}
+
+// networkIDCacheFor returns the network ID cache of the installer run for the
+// given Neutron endpoint and the credentials of the given cloud. The networks
+// a project sees depend on the credentials, so other credentials get another
+// cache even on the same endpoint.
+func networkIDCacheFor(endpoint string, cloud *clientconfig.Cloud) *networkIDCache {
+	var credentials struct {
+		AuthType clientconfig.AuthType
+		AuthInfo *clientconfig.AuthInfo
+		Region   string
+	}
+	if cloud != nil {
+		credentials.AuthType, credentials.AuthInfo, credentials.Region = cloud.AuthType, cloud.AuthInfo, cloud.RegionName
+	}
+	data, err := json.Marshal(credentials)
+	if err != nil {
+		// Without a key, the lookups are only shared by this resolver.
+		return newNetworkIDCache()
+	}
+	key := networkIDCacheKey{endpoint: endpoint, credentials: sha256.Sum256(data)}
+
+	networkIDCaches.mu.Lock()
+	defer networkIDCaches.mu.Unlock()
+	cache, ok := networkIDCaches.caches[key]
+	if !ok {
+		cache = newNetworkIDCache()
+		networkIDCaches.caches[key] = cache
+	}
+	return cache
+}
+
+// IDFromName returns the ID of the network with the given name, only querying
+// Neutron when the name wasn't resolved before. Failed lookups aren't cached.
+func (c *networkIDCache) IDFromName(ctx context.Context, client *gophercloud.ServiceClient, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	id, ok := c.ids[name]
+	c.mu.Unlock()
+	if ok {
+		return id, nil
+	}
+
+	// The lock isn't held during the lookup, which would serialize the lookups
+	// of unrelated names. Concurrent lookups of the same name may then both
+	// query Neutron, and agree on the ID.
+	id, err := networkIDFromName(withContext(ctx, client), name)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.ids[name] = id
+	c.mu.Unlock()
+	return id, nil
+}
+
+// networkIDFromName returns the ID of the network with the given name. Errors
+// when the number of networks found is not one. It stands for the IDFromName
+// of gophercloud/utils, whose signature changed across releases, with the
+// same errors.
+func networkIDFromName(client *gophercloud.ServiceClient, name string) (string, error) {
+	pages, err := networks.List(client, networks.ListOpts{
+		Name: name,
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	all, err := networks.ExtractNetworks(pages)
+	if err != nil {
+		return "", err
+	}
+
+	// Neutron filters on the name already, but the networks are matched
+	// again so that a Neutron ignoring the filter can't yield a wrong ID.
+	var IDs []string
+	for _, network := range all {
+		if network.Name == name {
+			IDs = append(IDs, network.ID)
+		}
+	}
+
+	switch count := len(IDs); count {
+	case 0:
+		return "", gophercloud.ErrResourceNotFound{Name: name, ResourceType: "network"}
+	case 1:
+		return IDs[0], nil
+	default:
+		return "", gophercloud.ErrMultipleResourcesFound{Name: name, Count: count, ResourceType: "network"}
+	}
+}
+
+// networkName returns the name of the network with the given ID.
+func networkName(client *gophercloud.ServiceClient, networkID string) (string, error) {
+	network, err := networks.Get(client, networkID).Extract()
+	if err != nil {
+		return "", err
+	}
+	return network.Name, nil
+}
+
+// isExternal reports whether the network with the given ID has the
+// router:external attribute set.
+func isExternal(client *gophercloud.ServiceClient, networkID string) (bool, error) {
+	var network struct {
+		networks.Network
+		external.NetworkExternalExt
+	}
+	if err := networks.Get(client, networkID).ExtractInto(&network); err != nil {
+		return false, err
+	}
+	return network.External, nil
+}
+
+// subnetIDFromName returns the ID of the subnet of the given network, or of
+// any network when empty, that matches the given name or ID. Errors when the
+// number of subnets found is not one.
+func subnetIDFromName(client *gophercloud.ServiceClient, networkID, name string) (string, error) {
+	pages, err := subnets.List(client, subnets.ListOpts{
+		NetworkID: networkID,
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	all, err := subnets.ExtractSubnets(pages)
+	if err != nil {
+		return "", err
+	}
+
+	var IDs []string
+	for _, subnet := range all {
+		if subnet.ID == name || subnet.Name == name {
+			IDs = append(IDs, subnet.ID)
+		}
+	}
+
+	switch count := len(IDs); count {
+	case 0:
+		return "", gophercloud.ErrResourceNotFound{Name: name, ResourceType: "subnet"}
+	case 1:
+		return IDs[0], nil
+	default:
+		return "", gophercloud.ErrMultipleResourcesFound{Name: name, Count: count, ResourceType: "subnet"}
+	}
+}
+
+// subnetIDFromCIDR returns the ID of the subnet of the given network whose
+// CIDR is the given one. Errors when the number of subnets found is not one.
+func subnetIDFromCIDR(client *gophercloud.ServiceClient, networkID, cidr string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return "", err
+	}
+
+	pages, err := subnets.List(client, subnets.ListOpts{
+		NetworkID: networkID,
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	all, err := subnets.ExtractSubnets(pages)
+	if err != nil {
+		return "", err
+	}
+
+	// Neutron stores the canonical form of the CIDR, which may differ from
+	// the one given, for instance in the notation of IPv6 addresses.
+	var IDs []string
+	for _, subnet := range all {
+		if _, subnetNet, err := net.ParseCIDR(subnet.CIDR); err == nil && subnetNet.String() == ipNet.String() {
+			IDs = append(IDs, subnet.ID)
+		}
+	}
+
+	switch count := len(IDs); count {
+	case 0:
+		return "", fmt.Errorf("no subnet with CIDR %s", cidr)
+	case 1:
+		return IDs[0], nil
+	default:
+		return "", fmt.Errorf("%d subnets with CIDR %s", count, cidr)
+	}
+}
+
+// subnetIDFromTag returns the ID of the subnet of the given network with the
+// given tag. Errors when the number of subnets found is not one.
+func subnetIDFromTag(client *gophercloud.ServiceClient, networkID, tag string) (string, error) {
+	pages, err := subnets.List(client, subnets.ListOpts{
+		NetworkID: networkID,
+		Tags:      tag,
+	}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	all, err := subnets.ExtractSubnets(pages)
+	if err != nil {
+		return "", err
+	}
+
+	switch count := len(all); count {
+	case 0:
+		return "", fmt.Errorf("no subnet tagged %s", tag)
+	case 1:
+		return all[0].ID, nil
+	default:
+		return "", fmt.Errorf("%d subnets tagged %s", count, tag)
+	}
+}
+
+// subnetNetworkID returns the ID of the network of the subnet with the given
+// ID.
+func subnetNetworkID(client *gophercloud.ServiceClient, subnetID string) (string, error) {
+	subnet, err := subnets.Get(client, subnetID).Extract()
+	if err != nil {
+		return "", err
+	}
+	return subnet.NetworkID, nil
+}
+
+// routerIDFromName returns the ID of the router that matches the given name
+// or ID. Errors when the number of routers found is not one.
+func routerIDFromName(client *gophercloud.ServiceClient, name string) (string, error) {
+	pages, err := routers.List(client, routers.ListOpts{}).AllPages()
+	if err != nil {
+		return "", err
+	}
+
+	all, err := routers.ExtractRouters(pages)
+	if err != nil {
+		return "", err
+	}
+
+	var IDs []string
+	for _, router := range all {
+		if router.ID == name || router.Name == name {
+			IDs = append(IDs, router.ID)
+		}
+	}
+
+	switch count := len(IDs); count {
+	case 0:
+		return "", gophercloud.ErrResourceNotFound{Name: name, ResourceType: "router"}
+	case 1:
+		return IDs[0], nil
+	default:
+		return "", gophercloud.ErrMultipleResourcesFound{Name: name, Count: count, ResourceType: "router"}
+	}
+}
+
+// regionIDs returns the IDs of the Keystone regions, listed through the
+// identity endpoint the given client authenticated against.
+func regionIDs(client *gophercloud.ServiceClient) ([]string, error) {
+	identityClient, err := openstack.NewIdentityV3(client.ProviderClient, gophercloud.EndpointOpts{})
+	if err != nil {
+		return nil, err
+	}
+	pages, err := regions.List(identityClient, nil).AllPages()
+	if err != nil {
+		return nil, err
+	}
+	all, err := regions.ExtractRegions(pages)
+	if err != nil {
+		return nil, err
+	}
+
+	IDs := make([]string, 0, len(all))
+	for _, region := range all {
+		IDs = append(IDs, region.ID)
+	}
+	return IDs, nil
+}
+
+// withRetries calls lookup until it succeeds, fails with an error that isn't
+// transient, or has been retried the given number of times. The delay between
+// two calls starts at baseDelay and doubles with every retry.
+func withRetries[T any](ctx context.Context, retries int, baseDelay time.Duration, lookup func() (T, error)) (T, error) {
+	delay := baseDelay
+	for attempt := 0; ; attempt++ {
+		result, err := lookup()
+		if err == nil || attempt >= retries || ctx.Err() != nil || !isTransient(err) {
+			return result, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			var zero T
+			return zero, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// isTransient reports whether a failed Neutron request is worth retrying:
+// Neutron is rate limiting or temporarily unavailable, or the request timed
+// out.
+func isTransient(err error) bool {
+	var statusErr gophercloud.StatusCodeError
+	if errors.As(err, &statusErr) {
+		switch statusErr.GetStatusCode() {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,1853 @@
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/openshift/installer/pkg/types"
+	"github.com/openshift/installer/pkg/types/openstack"
+)
+
+type fakeNetwork struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	External bool   `json:"router:external"`
+}
+
+type fakeRouter struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type fakeRegion struct {
+	ID string `json:"id"`
+}
+
+type fakeSubnet struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	NetworkID string   `json:"network_id"`
+	CIDR      string   `json:"cidr"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+func (s fakeSubnet) hasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeNeutron serves the network, subnet and router APIs of Neutron and counts
+// the network list requests it receives. It also serves the region API of
+// Keystone.
+type fakeNeutron struct {
+	server   *httptest.Server
+	networks []fakeNetwork
+	subnets  []fakeSubnet
+	routers  []fakeRouter
+	regions  []fakeRegion
+	requests int32
+}
+
+func newFakeNeutron(t testing.TB, networks ...fakeNetwork) *fakeNeutron {
+	f := &fakeNeutron{networks: networks}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/networks", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&f.requests, 1)
+
+		matches := []fakeNetwork{}
+		for _, n := range f.networks {
+			if name := r.URL.Query().Get("name"); name == "" || name == n.Name {
+				matches = append(matches, n)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"networks": matches})
+	})
+	mux.HandleFunc("/networks/", func(w http.ResponseWriter, r *http.Request) {
+		for _, n := range f.networks {
+			if r.URL.Path == "/networks/"+n.ID {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"network": n})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/subnets", func(w http.ResponseWriter, r *http.Request) {
+		matches := []fakeSubnet{}
+		for _, s := range f.subnets {
+			if networkID := r.URL.Query().Get("network_id"); networkID != "" && networkID != s.NetworkID {
+				continue
+			}
+			if tag := r.URL.Query().Get("tags"); tag != "" && !s.hasTag(tag) {
+				continue
+			}
+			matches = append(matches, s)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"subnets": matches})
+	})
+	mux.HandleFunc("/subnets/", func(w http.ResponseWriter, r *http.Request) {
+		for _, s := range f.subnets {
+			if r.URL.Path == "/subnets/"+s.ID {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"subnet": s})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/routers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"routers": f.routers})
+	})
+	mux.HandleFunc("/v3/regions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"regions": f.regions})
+	})
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func (f *fakeNeutron) client() *gophercloud.ServiceClient {
+	return &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{IdentityBase: f.server.URL + "/"},
+		Endpoint:       f.server.URL + "/",
+	}
+}
+
+// newFakeKeystone returns the auth URL of a fake Keystone, which issues tokens
+// to anyone with a service catalog pointing to the given Neutron, so that the
+// exported functions can authenticate against it.
+func newFakeKeystone(t testing.TB, neutron *fakeNeutron) string {
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", "fake-token")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"token": map[string]interface{}{
+				"expires_at": "2100-01-01T00:00:00.000000Z",
+				"catalog": []interface{}{
+					map[string]interface{}{
+						"type": "network",
+						"name": "neutron",
+						"endpoints": []interface{}{
+							map[string]interface{}{
+								"interface": "public",
+								"region":    "my_region",
+								"region_id": "my_region",
+								"url":       server.URL + "/",
+							},
+						},
+					},
+				},
+			},
+		})
+	})
+	// Clients built from the catalog send their requests under the version
+	// of the API.
+	mux.Handle("/v2.0/", http.StripPrefix("/v2.0", neutron.server.Config.Handler))
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server.URL + "/v3"
+}
+
+// setCloudsYAML points clouds.yaml to a file holding a single cloud named
+// openstack, authenticating against the given auth URL.
+func setCloudsYAML(t *testing.T, authURL string) {
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	content := `clouds:
+  openstack:
+    auth:
+      auth_url: ` + authURL + `
+      username: my_user
+      password: my_secret_password
+      project_id: f12f928576ae4d21bdb984da5dd1d3bf
+      user_domain_name: Default
+    region_name: my_region
+`
+	if err := os.WriteFile(cloudsYAML, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OS_CLIENT_CONFIG_FILE", cloudsYAML)
+}
+
+// fakeNetworkResolver resolves Neutron resources and Keystone regions from
+// static data, without any API call.
+type fakeNetworkResolver struct {
+	networks []fakeNetwork
+	subnets  []fakeSubnet
+	routers  []fakeRouter
+	regions  []fakeRegion
+}
+
+func (f fakeNetworkResolver) IDFromName(_ context.Context, name string) (string, error) {
+	var IDs []string
+	for _, network := range f.networks {
+		if network.Name == name {
+			IDs = append(IDs, network.ID)
+		}
+	}
+	return fakeUniqueID(IDs, name, "network")
+}
+
+func (f fakeNetworkResolver) NetworkName(_ context.Context, networkID string) (string, error) {
+	for _, network := range f.networks {
+		if network.ID == networkID {
+			return network.Name, nil
+		}
+	}
+	return "", gophercloud.ErrDefault404{}
+}
+
+func (f fakeNetworkResolver) IsExternal(_ context.Context, networkID string) (bool, error) {
+	for _, network := range f.networks {
+		if network.ID == networkID {
+			return network.External, nil
+		}
+	}
+	return false, gophercloud.ErrDefault404{}
+}
+
+func (f fakeNetworkResolver) SubnetIDFromName(_ context.Context, networkID, name string) (string, error) {
+	var IDs []string
+	for _, subnet := range f.subnets {
+		if (networkID == "" || subnet.NetworkID == networkID) && (subnet.ID == name || subnet.Name == name) {
+			IDs = append(IDs, subnet.ID)
+		}
+	}
+	return fakeUniqueID(IDs, name, "subnet")
+}
+
+func (f fakeNetworkResolver) SubnetIDFromCIDR(_ context.Context, networkID, cidr string) (string, error) {
+	var IDs []string
+	for _, subnet := range f.subnets {
+		if subnet.NetworkID == networkID && subnet.CIDR == cidr {
+			IDs = append(IDs, subnet.ID)
+		}
+	}
+	return fakeUniqueID(IDs, cidr, "subnet")
+}
+
+func (f fakeNetworkResolver) SubnetIDFromTag(_ context.Context, networkID, tag string) (string, error) {
+	var IDs []string
+	for _, subnet := range f.subnets {
+		if subnet.NetworkID == networkID && subnet.hasTag(tag) {
+			IDs = append(IDs, subnet.ID)
+		}
+	}
+	switch count := len(IDs); count {
+	case 0:
+		return "", fmt.Errorf("no subnet tagged %s", tag)
+	case 1:
+		return IDs[0], nil
+	default:
+		return "", fmt.Errorf("%d subnets tagged %s", count, tag)
+	}
+}
+
+func (f fakeNetworkResolver) SubnetNetworkID(_ context.Context, subnetID string) (string, error) {
+	for _, subnet := range f.subnets {
+		if subnet.ID == subnetID {
+			return subnet.NetworkID, nil
+		}
+	}
+	return "", gophercloud.ErrDefault404{}
+}
+
+func (f fakeNetworkResolver) RouterIDFromName(_ context.Context, name string) (string, error) {
+	var IDs []string
+	for _, router := range f.routers {
+		if router.ID == name || router.Name == name {
+			IDs = append(IDs, router.ID)
+		}
+	}
+	return fakeUniqueID(IDs, name, "router")
+}
+
+func (f fakeNetworkResolver) RegionIDs(_ context.Context) ([]string, error) {
+	IDs := make([]string, 0, len(f.regions))
+	for _, region := range f.regions {
+		IDs = append(IDs, region.ID)
+	}
+	return IDs, nil
+}
+
+func fakeUniqueID(IDs []string, name, resourceType string) (string, error) {
+	switch count := len(IDs); count {
+	case 0:
+		return "", gophercloud.ErrResourceNotFound{Name: name, ResourceType: resourceType}
+	case 1:
+		return IDs[0], nil
+	default:
+		return "", gophercloud.ErrMultipleResourcesFound{Name: name, Count: count, ResourceType: resourceType}
+	}
+}
+
+func TestNetworkEndpoint(t *testing.T) {
+	cases := []struct {
+		name             string
+		endpoint         string
+		expectedEndpoint string
+		expectedError    string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:             "with trailing slash",
+			endpoint:         "https://neutron.example.com:13696/",
+			expectedEndpoint: "https://neutron.example.com:13696/",
+		},
+		{
+			name:             "without trailing slash",
+			endpoint:         "http://192.0.2.10:9696",
+			expectedEndpoint: "http://192.0.2.10:9696/",
+		},
+		{
+			name:          "relative",
+			endpoint:      "neutron.example.com:9696",
+			expectedError: "invalid network endpoint neutron.example.com:9696: an absolute http or https URL is required",
+		},
+		{
+			name:          "unsupported scheme",
+			endpoint:      "ftp://neutron.example.com/",
+			expectedError: "invalid network endpoint ftp://neutron.example.com/: an absolute http or https URL is required",
+		},
+		{
+			name:          "malformed",
+			endpoint:      "https://[::1/",
+			expectedError: `invalid network endpoint: parse "https://[::1/": missing ']' in host`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			endpoint, err := networkEndpoint(tc.endpoint)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedEndpoint, endpoint)
+		})
+	}
+}
+
+func TestSetNetworkEndpoint(t *testing.T) {
+	catalogClient := func() *gophercloud.ServiceClient {
+		return &gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       "https://neutron.internal:9696/",
+			ResourceBase:   "https://neutron.internal:9696/v2.0/",
+		}
+	}
+
+	t.Run("unset", func(t *testing.T) {
+		client := catalogClient()
+		setNetworkEndpoint(client, "")
+		assert.Equal(t, "https://neutron.internal:9696/", client.Endpoint)
+		assert.Equal(t, "https://neutron.internal:9696/v2.0/networks", client.ServiceURL("networks"))
+	})
+
+	t.Run("set", func(t *testing.T) {
+		client := catalogClient()
+		setNetworkEndpoint(client, "https://neutron.example.com:13696/")
+		assert.Equal(t, "https://neutron.example.com:13696/", client.Endpoint)
+		assert.Equal(t, "https://neutron.example.com:13696/v2.0/networks", client.ServiceURL("networks"))
+	})
+}
+
+func TestNetworkIDFromName(t *testing.T) {
+	neutron := newFakeNeutron(t,
+		fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		fakeNetwork{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "duplicate"},
+		fakeNetwork{ID: "8e4b1c7d-2f3a-4b5c-9d6e-0a1b2c3d4e55", Name: "duplicate"},
+	)
+
+	cases := []struct {
+		name          string
+		networkName   string
+		expectedID    string
+		expectedError string
+	}{
+		{
+			name:        "one match",
+			networkName: "external",
+			expectedID:  "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+		},
+		{
+			name:          "no match",
+			networkName:   "missing",
+			expectedError: "Unable to find network with name missing",
+		},
+		{
+			name:          "no match by ID",
+			networkName:   "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+			expectedError: "Unable to find network with name a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+		},
+		{
+			name:          "several matches",
+			networkName:   "duplicate",
+			expectedError: "Found 2 networks matching duplicate",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := networkIDFromName(neutron.client(), tc.networkName)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedID, id)
+		})
+	}
+
+	t.Run("name filter ignored", func(t *testing.T) {
+		// Some Neutron deployments return every network whatever the filter.
+		mux := http.NewServeMux()
+		mux.HandleFunc("/networks", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"networks": []fakeNetwork{
+				{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "internal"},
+				{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+			}})
+		})
+		server := httptest.NewServer(mux)
+		t.Cleanup(server.Close)
+
+		id, err := networkIDFromName(&gophercloud.ServiceClient{
+			ProviderClient: &gophercloud.ProviderClient{},
+			Endpoint:       server.URL + "/",
+		}, "external")
+		assert.NoError(t, err)
+		assert.Equal(t, "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", id)
+	})
+}
+
+func TestNetworkIDCache(t *testing.T) {
+	neutron := newFakeNeutron(t, fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true})
+	cache := newNetworkIDCache()
+
+	for i := 0; i < 3; i++ {
+		id, err := cache.IDFromName(context.Background(), neutron.client(), "external")
+		assert.NoError(t, err)
+		assert.Equal(t, "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", id)
+	}
+	assert.EqualValues(t, 1, neutron.requests, "expected a single Neutron query")
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.IDFromName(context.Background(), neutron.client(), "missing")
+		assert.Error(t, err)
+	}
+	assert.EqualValues(t, 3, neutron.requests, "failed lookups must not be cached")
+}
+
+func TestNetworkIDCacheConcurrentLookups(t *testing.T) {
+	neutron := newFakeNeutron(t,
+		fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		fakeNetwork{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "other", External: true},
+	)
+	client := neutron.client()
+	cache := newNetworkIDCache()
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"external", "other", "external", "other"} {
+		name := name
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.IDFromName(context.Background(), client, name)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	id, err := cache.IDFromName(context.Background(), client, "other")
+	assert.NoError(t, err)
+	assert.Equal(t, "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", id)
+}
+
+func TestCloudProviderConfigExternalNetworkCached(t *testing.T) {
+	neutron := newFakeNeutron(t, fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true})
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				ExternalNetwork: "external",
+			},
+		},
+	}
+	cloud := clientconfig.Cloud{
+		AuthInfo:   &clientconfig.AuthInfo{},
+		RegionName: "my_region",
+	}
+
+	expectedConfig := `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+region = "my_region"
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+`
+	// Every generation gets its own resolver, as the assets of an installer
+	// run do.
+	for i := 0; i < 2; i++ {
+		actualConfig, _, err := generateCloudProviderConfig(context.Background(), newNeutronResolver(neutron.client(), &cloud), &cloud, NewCloudProviderOptions(installConfig))
+		assert.NoError(t, err, "unexpected error when generating cloud provider config")
+		assert.Equal(t, expectedConfig, actualConfig, "unexpected cloud provider config")
+	}
+	assert.EqualValues(t, 1, neutron.requests, "expected a single Neutron query")
+}
+
+func TestCloudProviderConfigExternalNetworkNotShared(t *testing.T) {
+	neutron := newFakeNeutron(t, fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true})
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				ExternalNetwork: "external",
+			},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{ProjectID: "f12f928576ae4d21bdb984da5dd1d3bf"}}
+
+	config, _, err := generateCloudProviderConfig(context.Background(), newNeutronResolver(neutron.client(), &cloud), &cloud, NewCloudProviderOptions(installConfig))
+	assert.NoError(t, err)
+	assert.Contains(t, config, "floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11\n")
+
+	// The project of another cloud on the same Neutron endpoint sees another
+	// network by that name.
+	neutron.networks = []fakeNetwork{{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "external", External: true}}
+	other := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{ProjectID: "2b1c2cb0d04b4e8a9f2f3c4d5e6f7a8b"}}
+	config, _, err = generateCloudProviderConfig(context.Background(), newNeutronResolver(neutron.client(), &other), &other, NewCloudProviderOptions(installConfig))
+	assert.NoError(t, err)
+	assert.Contains(t, config, "floating-network-id = 62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22\n", "other credentials must not share cached IDs")
+	assert.EqualValues(t, 2, neutron.requests)
+
+	// The same credentials on another Neutron endpoint don't either.
+	otherNeutron := newFakeNeutron(t, fakeNetwork{ID: "7d3f0c1e-5a2b-4c8d-9e6f-3b2a1c0d9e83", Name: "external", External: true})
+	config, _, err = generateCloudProviderConfig(context.Background(), newNeutronResolver(otherNeutron.client(), &cloud), &cloud, NewCloudProviderOptions(installConfig))
+	assert.NoError(t, err)
+	assert.Contains(t, config, "floating-network-id = 7d3f0c1e-5a2b-4c8d-9e6f-3b2a1c0d9e83\n", "other endpoints must not share cached IDs")
+	assert.EqualValues(t, 1, otherNeutron.requests)
+}
+
+func TestCloudProviderConfigExternalNetworkCancelled(t *testing.T) {
+	lookupStarted := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/networks", func(w http.ResponseWriter, r *http.Request) {
+		// Hang like an unresponsive Neutron until the lookup is cancelled.
+		close(lookupStarted)
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := &gophercloud.ServiceClient{
+		ProviderClient: &gophercloud.ProviderClient{},
+		Endpoint:       server.URL + "/",
+	}
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				ExternalNetwork: "external",
+			},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-lookupStarted
+		cancel()
+	}()
+
+	_, _, err := generateCloudProviderConfig(ctx, newNeutronResolver(client, &cloud), &cloud, NewCloudProviderOptions(installConfig))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorAs(t, err, new(Error))
+	assert.Nil(t, client.ProviderClient.Context, "the context must not leak into the shared client")
+}
+
+// flakyNetworkResolver fails the network lookups with the given errors before
+// delegating them to the wrapped resolver.
+type flakyNetworkResolver struct {
+	fakeNetworkResolver
+	errs  []error
+	calls int
+}
+
+func (f *flakyNetworkResolver) IDFromName(ctx context.Context, name string) (string, error) {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return "", f.errs[f.calls-1]
+	}
+	return f.fakeNetworkResolver.IDFromName(ctx, name)
+}
+
+func TestCloudProviderConfigExternalNetworkRetries(t *testing.T) {
+	unavailable := gophercloud.ErrDefault503{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusServiceUnavailable}}
+	notFound := gophercloud.ErrDefault404{ErrUnexpectedResponseCode: gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusNotFound}}
+
+	cases := []struct {
+		name          string
+		errs          []error
+		expectedCalls int
+		expectedError string
+	}{
+		{
+			name:          "transient failures",
+			errs:          []error{unavailable, unavailable},
+			expectedCalls: 3,
+		},
+		{
+			name:          "not found",
+			errs:          []error{notFound},
+			expectedCalls: 1,
+			expectedError: "failed to fetch external network external: Resource not found",
+		},
+		{
+			name:          "retries exhausted",
+			errs:          []error{unavailable, unavailable, unavailable, unavailable},
+			expectedCalls: 3,
+			expectedError: "failed to fetch external network external: The service is currently unable to handle the request",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resolver := &flakyNetworkResolver{
+				fakeNetworkResolver: fakeNetworkResolver{
+					networks: []fakeNetwork{
+						{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+					},
+				},
+				errs: tc.errs,
+			}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: "external",
+					},
+				},
+			}
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig), WithLookupRetries(2, time.Millisecond))
+			assert.Equal(t, tc.expectedCalls, resolver.calls)
+			if tc.expectedError != "" {
+				assert.ErrorContains(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, config, "floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11\n")
+		})
+	}
+}
+
+func BenchmarkNetworkIDCache(b *testing.B) {
+	neutron := newFakeNeutron(b, fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true})
+	client := neutron.client()
+	cache := newNetworkIDCache()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.IDFromName(context.Background(), client, "external"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCloudProviderConfigExternalNetworkID(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	for _, network := range []string{"", "external"} {
+		installConfig := types.InstallConfig{
+			Networking: &types.Networking{},
+			Platform: types.Platform{
+				OpenStack: &openstack.Platform{
+					ExternalNetwork: network,
+				},
+			},
+		}
+
+		config, _, networkIDs, err := generateCloudProviderConfigAndNetworkIDs(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+		assert.NoError(t, err, "unexpected error when generating cloud provider config")
+		if network == "" {
+			assert.Empty(t, networkIDs)
+			assert.NotContains(t, config, "floating-network-id")
+			continue
+		}
+		assert.Equal(t, []string{"a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11"}, networkIDs)
+		assert.Contains(t, config, "floating-network-id = "+networkIDs[0]+"\n")
+	}
+}
+
+func TestCloudProviderConfigExternalNetworkUUID(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name              string
+		network           string
+		expectedNetworkID string
+		expectedError     string
+	}{
+		{
+			name:              "uuid",
+			network:           "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+			expectedNetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+		},
+		{
+			name:              "name",
+			network:           "external",
+			expectedNetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11",
+		},
+		{
+			name:          "uuid of a nonexistent network",
+			network:       "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22",
+			expectedError: "failed to find external network with ID 62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22: no network found",
+		},
+		{
+			name:          "nonexistent name",
+			network:       "missing",
+			expectedError: "failed to find external network missing: no network found",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.network,
+					},
+				},
+			}
+
+			_, _, networkIDs, err := generateCloudProviderConfigAndNetworkIDs(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig), WithLookupRetries(0, 0))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.ErrorIs(t, err, ErrNetworkNotFound)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, []string{tc.expectedNetworkID}, networkIDs)
+		})
+	}
+}
+
+func TestCloudProviderConfigAdditionalExternalNetworks(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+			{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "external-2", External: true},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name               string
+		network            string
+		additionalNetworks []string
+		expectedNetworkIDs []string
+		expectedError      string
+	}{
+		{
+			name:               "one",
+			network:            "external",
+			expectedNetworkIDs: []string{"a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11"},
+		},
+		{
+			name:               "two",
+			network:            "external",
+			additionalNetworks: []string{"external-2"},
+			expectedNetworkIDs: []string{"a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22"},
+		},
+		{
+			name:               "duplicate name",
+			network:            "external",
+			additionalNetworks: []string{"external-2", "external"},
+			expectedError:      "invalid external network external: the network is listed twice",
+		},
+		{
+			name:               "duplicate ID",
+			network:            "external",
+			additionalNetworks: []string{"a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11"},
+			expectedError:      "invalid external network a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11: the network is the same as external (a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11)",
+		},
+		{
+			name:               "unresolvable",
+			network:            "external",
+			additionalNetworks: []string{"missing"},
+			expectedError:      "failed to find external network missing: no network found",
+		},
+		{
+			name:               "without external network",
+			additionalNetworks: []string{"external-2"},
+			expectedError:      "invalid additional external networks: an external network is required",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.network,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{
+								AdditionalExternalNetworks: tc.additionalNetworks,
+							},
+						},
+					},
+				},
+			}
+
+			config, _, networkIDs, err := generateCloudProviderConfigAndNetworkIDs(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig), WithLookupRetries(0, 0))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedNetworkIDs, networkIDs)
+			assert.Contains(t, config, "floating-network-id = "+tc.expectedNetworkIDs[0]+"\n")
+		})
+	}
+}
+
+func TestCloudProviderConfigExternalNetworkErrors(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "duplicate", External: true},
+			{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "duplicate", External: true},
+		},
+	}
+
+	cases := []struct {
+		name          string
+		network       string
+		expectedErr   error
+		expectedError string
+	}{
+		{
+			name:          "not found",
+			network:       "missing",
+			expectedErr:   ErrNetworkNotFound,
+			expectedError: "failed to find external network missing: no network found",
+		},
+		{
+			name:          "ambiguous",
+			network:       "duplicate",
+			expectedErr:   ErrAmbiguousNetwork,
+			expectedError: "external network name duplicate is ambiguous: more than one network found (2 matches)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.network,
+					},
+				},
+			}
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+			_, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			assert.EqualError(t, err, tc.expectedError)
+			assert.ErrorIs(t, err, tc.expectedErr)
+			assert.ErrorAs(t, err, new(Error))
+		})
+	}
+}
+
+func TestSubnetIDFromName(t *testing.T) {
+	neutron := newFakeNeutron(t)
+	neutron.subnets = []fakeSubnet{
+		{ID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61", Name: "fip", NetworkID: "external-id"},
+		{ID: "0c4e2b6a-3d1f-4e8a-9b7c-5a6d4e3f2b12", Name: "duplicate", NetworkID: "external-id"},
+		{ID: "9f1e3d5c-7b2a-4c8e-a6d4-2b0c8e6a4f23", Name: "duplicate", NetworkID: "external-id"},
+		{ID: "3b5d7f9a-1c2e-4a6b-8d0f-7e9c1a3b5d34", Name: "other", NetworkID: "other-id"},
+	}
+
+	cases := []struct {
+		name          string
+		subnet        string
+		expectedID    string
+		expectedError string
+	}{
+		{
+			name:       "by name",
+			subnet:     "fip",
+			expectedID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61",
+		},
+		{
+			name:       "by ID",
+			subnet:     "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61",
+			expectedID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61",
+		},
+		{
+			name:          "in another network",
+			subnet:        "other",
+			expectedError: "Unable to find subnet with name other",
+		},
+		{
+			name:          "ambiguous",
+			subnet:        "duplicate",
+			expectedError: "Found 2 subnets matching duplicate",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := subnetIDFromName(neutron.client(), "external-id", tc.subnet)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedID, id)
+		})
+	}
+}
+
+func TestSubnetIDFromCIDR(t *testing.T) {
+	neutron := newFakeNeutron(t)
+	neutron.subnets = []fakeSubnet{
+		{ID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61", Name: "fip", NetworkID: "external-id", CIDR: "203.0.113.0/24"},
+		{ID: "0c4e2b6a-3d1f-4e8a-9b7c-5a6d4e3f2b12", Name: "fip-v6", NetworkID: "external-id", CIDR: "2001:db8::/64"},
+		{ID: "9f1e3d5c-7b2a-4c8e-a6d4-2b0c8e6a4f23", Name: "duplicate", NetworkID: "external-id", CIDR: "198.51.100.0/24"},
+		{ID: "3b5d7f9a-1c2e-4a6b-8d0f-7e9c1a3b5d34", Name: "duplicate", NetworkID: "external-id", CIDR: "198.51.100.0/24"},
+		{ID: "5a7c9e1b-3d5f-4b7d-9f1a-3c5e7a9b1d45", Name: "other", NetworkID: "other-id", CIDR: "192.0.2.0/24"},
+	}
+
+	cases := []struct {
+		name          string
+		cidr          string
+		expectedID    string
+		expectedError string
+	}{
+		{
+			name:       "one match",
+			cidr:       "203.0.113.0/24",
+			expectedID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61",
+		},
+		{
+			name:       "non-canonical IPv6",
+			cidr:       "2001:0db8:0000::/64",
+			expectedID: "0c4e2b6a-3d1f-4e8a-9b7c-5a6d4e3f2b12",
+		},
+		{
+			name:          "no match",
+			cidr:          "192.0.2.0/24",
+			expectedError: "no subnet with CIDR 192.0.2.0/24",
+		},
+		{
+			name:          "two matches",
+			cidr:          "198.51.100.0/24",
+			expectedError: "2 subnets with CIDR 198.51.100.0/24",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := subnetIDFromCIDR(neutron.client(), "external-id", tc.cidr)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedID, id)
+		})
+	}
+}
+
+func TestSubnetIDFromTag(t *testing.T) {
+	neutron := newFakeNeutron(t)
+	neutron.subnets = []fakeSubnet{
+		{ID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61", Name: "fip", NetworkID: "external-id", Tags: []string{"fip", "ipv4"}},
+		{ID: "9f1e3d5c-7b2a-4c8e-a6d4-2b0c8e6a4f23", Name: "fip-a", NetworkID: "external-id", Tags: []string{"ha"}},
+		{ID: "3b5d7f9a-1c2e-4a6b-8d0f-7e9c1a3b5d34", Name: "fip-b", NetworkID: "external-id", Tags: []string{"ha"}},
+		{ID: "5a7c9e1b-3d5f-4b7d-9f1a-3c5e7a9b1d45", Name: "other", NetworkID: "other-id", Tags: []string{"other"}},
+	}
+
+	cases := []struct {
+		name          string
+		tag           string
+		expectedID    string
+		expectedError string
+	}{
+		{
+			name:       "one match",
+			tag:        "fip",
+			expectedID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61",
+		},
+		{
+			name:          "no match",
+			tag:           "other",
+			expectedError: "no subnet tagged other",
+		},
+		{
+			name:          "two matches",
+			tag:           "ha",
+			expectedError: "2 subnets tagged ha",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := subnetIDFromTag(neutron.client(), "external-id", tc.tag)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedID, id)
+		})
+	}
+}
+
+func TestSubnetNetworkID(t *testing.T) {
+	neutron := newFakeNeutron(t)
+	neutron.subnets = []fakeSubnet{
+		{ID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61", Name: "fip", NetworkID: "external-id"},
+	}
+
+	networkID, err := subnetNetworkID(neutron.client(), "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61")
+	assert.NoError(t, err)
+	assert.Equal(t, "external-id", networkID)
+
+	_, err = subnetNetworkID(neutron.client(), "3b5d7f9a-1c2e-4a6b-8d0f-7e9c1a3b5d34")
+	assert.Error(t, err)
+}
+
+// misplacedSubnetResolver finds the subnets of other-id whichever network they
+// are looked up in, but reports their actual network when they are fetched.
+type misplacedSubnetResolver struct {
+	fakeNetworkResolver
+}
+
+func (r misplacedSubnetResolver) SubnetIDFromName(ctx context.Context, _, name string) (string, error) {
+	return r.fakeNetworkResolver.SubnetIDFromName(ctx, "other-id", name)
+}
+
+func TestCloudProviderConfigFloatingSubnet(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+		subnets: []fakeSubnet{
+			{ID: "7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61", Name: "fip", NetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", CIDR: "203.0.113.0/24", Tags: []string{"fip"}},
+			{ID: "9f1e3d5c-7b2a-4c8e-a6d4-2b0c8e6a4f23", Name: "fip-a", NetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", CIDR: "198.51.100.0/25", Tags: []string{"ha"}},
+			{ID: "3b5d7f9a-1c2e-4a6b-8d0f-7e9c1a3b5d34", Name: "fip-b", NetworkID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", CIDR: "198.51.100.128/25", Tags: []string{"ha"}},
+		},
+	}
+
+	cases := []struct {
+		name              string
+		resolver          networkResolver
+		externalNetwork   string
+		floatingSubnet    string
+		floatingSubnetTag string
+		expectedConfig    string
+		expectedError     string
+	}{
+		{
+			name:            "floating subnet by name",
+			externalNetwork: "external",
+			floatingSubnet:  "fip",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+floating-subnet-id = 7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61
+`,
+		},
+		{
+			name:            "floating subnet by CIDR",
+			externalNetwork: "external",
+			floatingSubnet:  "203.0.113.0/24",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+floating-subnet-id = 7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61
+`,
+		},
+		{
+			name:            "floating subnet not found",
+			externalNetwork: "external",
+			floatingSubnet:  "missing",
+			expectedError:   "failed to find floating subnet missing in external network external: Unable to find subnet with name missing",
+		},
+		{
+			name:           "floating subnet without external network",
+			floatingSubnet: "fip",
+			expectedError:  "invalid floating subnet fip: an external network is required",
+		},
+		{
+			name:              "floating subnet by tag",
+			externalNetwork:   "external",
+			floatingSubnetTag: "fip",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+floating-subnet-id = 7d8a3f1c-5a9e-4c6b-8f2d-1e0b9c8a7d61
+`,
+		},
+		{
+			name:              "no floating subnet with the tag",
+			externalNetwork:   "external",
+			floatingSubnetTag: "missing",
+			expectedError:     "failed to find floating subnet tagged missing in external network external: no subnet tagged missing",
+		},
+		{
+			name:              "several floating subnets with the tag",
+			externalNetwork:   "external",
+			floatingSubnetTag: "ha",
+			expectedError:     "failed to find floating subnet tagged ha in external network external: 2 subnets tagged ha",
+		},
+		{
+			name:              "floating subnet tag without external network",
+			floatingSubnetTag: "fip",
+			expectedError:     "invalid floating subnet tagged fip: an external network is required",
+		},
+		{
+			name:              "floating subnet tag with floating subnet",
+			externalNetwork:   "external",
+			floatingSubnet:    "fip",
+			floatingSubnetTag: "fip",
+			expectedError:     "invalid floating subnet tag fip: conflicts with the floating subnet fip",
+		},
+		{
+			name: "floating subnet in another network",
+			resolver: misplacedSubnetResolver{fakeNetworkResolver{
+				networks: resolver.networks,
+				subnets: []fakeSubnet{
+					{ID: "3b5d7f9a-1c2e-4a6b-8d0f-7e9c1a3b5d34", Name: "other", NetworkID: "other-id"},
+				},
+			}},
+			externalNetwork: "external",
+			floatingSubnet:  "other",
+			expectedError:   "invalid floating subnet other: the subnet belongs to network other-id, not to the external network external (a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.externalNetwork,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{
+								FloatingSubnet:    tc.floatingSubnet,
+								FloatingSubnetTag: tc.floatingSubnetTag,
+							},
+						},
+					},
+				},
+			}
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+			var networkClient networkResolver = resolver
+			if tc.resolver != nil {
+				networkClient = tc.resolver
+			}
+
+			actualConfig, _, err := generateCloudProviderConfig(context.Background(), networkClient, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, actualConfig, "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigMemberSubnet(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		subnets: []fakeSubnet{
+			{ID: "3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10", Name: "nodes", NetworkID: "machines-id", CIDR: "10.0.0.0/16"},
+			{ID: "9c1d3e5f-7a9b-4c2d-8e0f-1a3b5c7d9e21", Name: "storage", NetworkID: "machines-id", CIDR: "10.1.0.0/16"},
+			{ID: "5e7a9c1b-3d5f-4a7c-9e1b-3d5f7a9c1e43", Name: "nodes", NetworkID: "other-id", CIDR: "10.2.0.0/16"},
+		},
+	}
+
+	cases := []struct {
+		name             string
+		memberSubnet     string
+		machinesSubnet   string
+		controlPlanePort *openstack.PortTarget
+		expectedConfig   string
+		expectedError    string
+	}{
+		{
+			name: "unset",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`,
+		},
+		{
+			name:         "member subnet by name",
+			memberSubnet: "storage",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+subnet-id = 9c1d3e5f-7a9b-4c2d-8e0f-1a3b5c7d9e21
+`,
+		},
+		{
+			name:         "member subnet by ID",
+			memberSubnet: "3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+subnet-id = 3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10
+`,
+		},
+		{
+			name:          "member subnet not found",
+			memberSubnet:  "missing",
+			expectedError: "failed to find member subnet missing: Unable to find subnet with name missing",
+		},
+		{
+			name:          "ambiguous member subnet",
+			memberSubnet:  "nodes",
+			expectedError: "failed to find member subnet nodes: Found 2 subnets matching nodes",
+		},
+		{
+			name:         "member subnet overriding the machines subnet",
+			memberSubnet: "storage",
+			controlPlanePort: &openstack.PortTarget{
+				FixedIPs: []openstack.FixedIP{{Subnet: openstack.SubnetFilter{ID: "3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10"}}},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+subnet-id = 9c1d3e5f-7a9b-4c2d-8e0f-1a3b5c7d9e21
+`,
+		},
+		{
+			name: "default to the subnet of the control plane port",
+			controlPlanePort: &openstack.PortTarget{
+				Network:  openstack.NetworkFilter{ID: "machines-id"},
+				FixedIPs: []openstack.FixedIP{{Subnet: openstack.SubnetFilter{Name: "nodes"}}},
+			},
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+subnet-id = 3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10
+`,
+		},
+		{
+			name:           "default to the machines subnet",
+			machinesSubnet: "3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+subnet-id = 3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						DeprecatedMachinesSubnet: tc.machinesSubnet,
+						ControlPlanePort:         tc.controlPlanePort,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{
+								MemberSubnet: tc.memberSubnet,
+							},
+						},
+					},
+				},
+			}
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+			actualConfig, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err, "unexpected error when generating cloud provider config")
+			assert.Equal(t, tc.expectedConfig, actualConfig, "unexpected cloud provider config")
+		})
+	}
+}
+
+func TestCloudProviderConfigExternalNetworkName(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+
+	cases := []struct {
+		name           string
+		network        string
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name:    "unset",
+			network: "",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`,
+		},
+		{
+			name:          "blank",
+			network:       " ",
+			expectedError: `invalid external network " ": the name is blank`,
+		},
+		{
+			name:    "valid",
+			network: " external\t",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[LoadBalancer]
+floating-network-id = a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11
+`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.network,
+					},
+				},
+			}
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, config)
+		})
+	}
+}
+
+func TestRouterIDFromName(t *testing.T) {
+	neutron := newFakeNeutron(t)
+	neutron.routers = []fakeRouter{
+		{ID: "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51", Name: "router"},
+		{ID: "1a2b3c4d-5e6f-4a8b-9c0d-1e2f3a4b5c62", Name: "duplicate"},
+		{ID: "6f5e4d3c-2b1a-4c9d-8e7f-6a5b4c3d2e73", Name: "duplicate"},
+	}
+
+	cases := []struct {
+		name          string
+		router        string
+		expectedID    string
+		expectedError string
+	}{
+		{
+			name:       "by name",
+			router:     "router",
+			expectedID: "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51",
+		},
+		{
+			name:       "by ID",
+			router:     "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51",
+			expectedID: "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51",
+		},
+		{
+			name:          "not found",
+			router:        "missing",
+			expectedError: "Unable to find router with name missing",
+		},
+		{
+			name:          "ambiguous",
+			router:        "duplicate",
+			expectedError: "Found 2 routers matching duplicate",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := routerIDFromName(neutron.client(), tc.router)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedID, id)
+		})
+	}
+}
+
+func TestRegionIDs(t *testing.T) {
+	neutron := newFakeNeutron(t)
+	neutron.regions = []fakeRegion{{ID: "RegionOne"}, {ID: "RegionTwo"}}
+
+	IDs, err := regionIDs(neutron.client())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"RegionOne", "RegionTwo"}, IDs)
+}
+
+func TestCloudProviderConfigRoute(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		routers: []fakeRouter{
+			{ID: "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51", Name: "router"},
+		},
+	}
+
+	cases := []struct {
+		name           string
+		router         string
+		expectedConfig string
+		expectedError  string
+	}{
+		{
+			name:   "router by name",
+			router: "router",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[Route]
+router-id = 5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51
+`,
+		},
+		{
+			name:   "router by ID",
+			router: "5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+
+[Route]
+router-id = 5e1c9b2a-8d4f-4a3e-b6c7-0f9e8d7c6b51
+`,
+		},
+		{
+			name: "no router",
+			expectedConfig: `[Global]
+secret-name = openstack-credentials
+secret-namespace = kube-system
+`,
+		},
+		{
+			name:          "router not found",
+			router:        "missing",
+			expectedError: "failed to find router missing: Unable to find router with name missing",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Route: &openstack.CloudProviderRoute{
+								Router: tc.router,
+							},
+						},
+					},
+				},
+			}
+			cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, config)
+		})
+	}
+}
+
+func TestCloudProviderConfigRegionValidation(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		regions: []fakeRegion{{ID: "RegionTwo"}, {ID: "RegionOne"}},
+	}
+
+	cases := []struct {
+		name          string
+		region        string
+		resolver      networkResolver
+		disabled      bool
+		expectedError string
+	}{
+		{
+			name:     "known region",
+			region:   "RegionOne",
+			resolver: resolver,
+		},
+		{
+			name:          "unknown region",
+			region:        "RegionOen",
+			resolver:      resolver,
+			expectedError: `invalid region "RegionOen": the cloud has no such region, available regions: RegionOne, RegionTwo`,
+		},
+		{
+			name:     "unknown region without validation",
+			region:   "RegionOen",
+			resolver: resolver,
+			disabled: true,
+		},
+		{
+			name:   "unknown region without network client",
+			region: "RegionOen",
+		},
+		{
+			name:     "no region",
+			resolver: resolver,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{},
+				},
+			}
+			cloud := clientconfig.Cloud{
+				AuthInfo:   &clientconfig.AuthInfo{},
+				RegionName: tc.region,
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), tc.resolver, &cloud, NewCloudProviderOptions(installConfig), WithRegionValidation(!tc.disabled))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.region != "" {
+				assert.Contains(t, config, "region = \""+tc.region+"\"\n")
+			}
+		})
+	}
+}
+
+func TestNetworkName(t *testing.T) {
+	neutron := newFakeNeutron(t,
+		fakeNetwork{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "machines"},
+	)
+
+	name, err := networkName(neutron.client(), "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22")
+	assert.NoError(t, err)
+	assert.Equal(t, "machines", name)
+
+	_, err = networkName(neutron.client(), "missing")
+	assert.Error(t, err)
+}
+
+func TestIsExternal(t *testing.T) {
+	neutron := newFakeNeutron(t,
+		fakeNetwork{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		fakeNetwork{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "internal"},
+	)
+
+	external, err := isExternal(neutron.client(), "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11")
+	assert.NoError(t, err)
+	assert.True(t, external)
+
+	external, err = isExternal(neutron.client(), "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22")
+	assert.NoError(t, err)
+	assert.False(t, external)
+}
+
+func TestCloudProviderConfigExternalNetworkNotExternal(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+			{ID: "62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22", Name: "internal"},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		network       string
+		expectedError string
+	}{
+		{
+			network: "external",
+		},
+		{
+			network:       "internal",
+			expectedError: "external network internal is not usable for floating IPs: network 62c2e8f0-7b7b-4d3c-9a0e-1f7c6a3f2b22 is not external (router:external is false)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.network, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.network,
+					},
+				},
+			}
+
+			_, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCloudProviderConfigPublicNetworkFromExternalNetwork(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name               string
+		externalNetwork    string
+		networking         *openstack.CloudProviderNetworking
+		expectedNetworking string
+	}{
+		{
+			name:            "disabled",
+			externalNetwork: "external",
+			networking: &openstack.CloudProviderNetworking{
+				PublicNetworkNames: []string{"public"},
+			},
+			expectedNetworking: `[Networking]
+public-network-name = "public"
+`,
+		},
+		{
+			name:            "enabled",
+			externalNetwork: "external",
+			networking: &openstack.CloudProviderNetworking{
+				PublicNetworkNames:               []string{"public"},
+				PublicNetworkFromExternalNetwork: true,
+			},
+			expectedNetworking: `[Networking]
+public-network-name = "external"
+public-network-name = "public"
+`,
+		},
+		{
+			name:            "enabled with the external network already listed",
+			externalNetwork: "external",
+			networking: &openstack.CloudProviderNetworking{
+				PublicNetworkNames:               []string{"external"},
+				PublicNetworkFromExternalNetwork: true,
+			},
+			expectedNetworking: `[Networking]
+public-network-name = "external"
+`,
+		},
+		{
+			name: "enabled without external network",
+			networking: &openstack.CloudProviderNetworking{
+				PublicNetworkFromExternalNetwork: true,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.externalNetwork,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							Networking: tc.networking,
+						},
+					},
+				},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			assert.NoError(t, err)
+			if tc.expectedNetworking == "" {
+				assert.NotContains(t, config, "[Networking]")
+				return
+			}
+			assert.Contains(t, config, tc.expectedNetworking)
+		})
+	}
+}
+
+func TestCloudProviderConfigInternalNetworkFromMachineSubnet(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "machines-id", Name: "machines"},
+		},
+		subnets: []fakeSubnet{
+			{ID: "3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10", Name: "nodes", NetworkID: "machines-id", CIDR: "10.0.0.0/16"},
+		},
+	}
+	cloud := clientconfig.Cloud{AuthInfo: &clientconfig.AuthInfo{}}
+
+	cases := []struct {
+		name               string
+		machinesSubnet     string
+		networking         *openstack.CloudProviderNetworking
+		expectedNetworking string
+		expectedError      string
+	}{
+		{
+			name:           "disabled",
+			machinesSubnet: "3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10",
+			networking: &openstack.CloudProviderNetworking{
+				InternalNetworkNames: []string{"storage"},
+			},
+			expectedNetworking: `[Networking]
+internal-network-name = "storage"
+`,
+		},
+		{
+			name:           "enabled",
+			machinesSubnet: "3b9f6e2d-1c4a-4d8b-9e7f-6a5c4b3d2e10",
+			networking: &openstack.CloudProviderNetworking{
+				InternalNetworkNames:             []string{"storage"},
+				InternalNetworkFromMachineSubnet: true,
+			},
+			expectedNetworking: `[Networking]
+internal-network-name = "machines"
+internal-network-name = "storage"
+`,
+		},
+		{
+			name:           "enabled with the machine network already listed",
+			machinesSubnet: "nodes",
+			networking: &openstack.CloudProviderNetworking{
+				InternalNetworkNames:             []string{"machines"},
+				InternalNetworkFromMachineSubnet: true,
+			},
+			expectedNetworking: `[Networking]
+internal-network-name = "machines"
+`,
+		},
+		{
+			name: "enabled without machine subnet",
+			networking: &openstack.CloudProviderNetworking{
+				InternalNetworkFromMachineSubnet: true,
+			},
+		},
+		{
+			name:           "machine subnet not found",
+			machinesSubnet: "missing",
+			networking: &openstack.CloudProviderNetworking{
+				InternalNetworkFromMachineSubnet: true,
+			},
+			expectedError: "failed to find machine subnet missing: Unable to find subnet with name missing",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						DeprecatedMachinesSubnet: tc.machinesSubnet,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{Disabled: true},
+							Networking:   tc.networking,
+						},
+					},
+				},
+			}
+
+			config, _, err := generateCloudProviderConfig(context.Background(), resolver, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.expectedNetworking == "" {
+				assert.NotContains(t, config, "[Networking]")
+				return
+			}
+			assert.Contains(t, config, tc.expectedNetworking)
+		})
+	}
+}
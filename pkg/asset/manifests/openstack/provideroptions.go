@@ -0,0 +1,73 @@
+package openstack
+
+import (
+	"github.com/openshift/installer/pkg/types"
+	openstacktypes "github.com/openshift/installer/pkg/types/openstack"
+)
+
+// CloudProviderOptions holds every setting of the cluster the cloud provider
+// config is generated from, wherever it is set in the install config.
+// NewCloudProviderOptions derives them from an install config.
+type CloudProviderOptions struct {
+	// Config holds the settings of the sections of the cloud provider config.
+	// Every setting is optional.
+	Config *openstacktypes.CloudProviderConfig
+
+	// Cloud is the name of the entry of clouds.yaml the cluster is installed
+	// with, which the cloud provider reads its credentials from in the clouds
+	// file mode.
+	Cloud string
+
+	// ExternalNetwork is the name or ID of the network the floating IPs of
+	// the load balancers are allocated from. The load balancers get no
+	// floating IP when it is empty.
+	ExternalNetwork string
+
+	// MemberSubnet is the name or ID of the subnet the members of the load
+	// balancers are placed in, either the one of the cloud provider config or
+	// the subnet of the machines.
+	MemberSubnet string
+
+	// MemberSubnetNetworkID is the ID of the network of MemberSubnet, when
+	// known. The subnet is looked up in every network when empty.
+	MemberSubnetNetworkID string
+
+	// MachineSubnet is the name or ID of the subnet of the machines set in
+	// the install config, if any.
+	MachineSubnet string
+
+	// MachineSubnetNetworkID is the ID of the network of MachineSubnet, when
+	// known. The subnet is looked up in every network when empty.
+	MachineSubnetNetworkID string
+
+	// RootVolumeZones are the Cinder availability zones the root volumes of
+	// the machines are created in.
+	RootVolumeZones []string
+
+	// NodeVolumeAttachLimit is the maximum number of Cinder volumes attached
+	// to a node set on the default machine platform.
+	NodeVolumeAttachLimit *int
+}
+
+// NewCloudProviderOptions returns the settings of the cloud provider config of
+// the given install config. They are empty for the install configs of other
+// platforms.
+func NewCloudProviderOptions(installConfig types.InstallConfig) CloudProviderOptions {
+	platform := installConfig.OpenStack
+	if platform == nil {
+		return CloudProviderOptions{}
+	}
+
+	res := CloudProviderOptions{
+		Config:          platform.CloudProviderConfig,
+		Cloud:           platform.Cloud,
+		ExternalNetwork: platform.ExternalNetwork,
+		RootVolumeZones: rootVolumeZones(installConfig),
+	}
+	res.MemberSubnet, res.MemberSubnetNetworkID = memberSubnet(platform)
+	res.MachineSubnet, res.MachineSubnetNetworkID = machineSubnet(platform)
+	if platform.DefaultMachinePlatform != nil {
+		res.NodeVolumeAttachLimit = platform.DefaultMachinePlatform.NodeVolumeAttachLimit
+	}
+	return res
+}
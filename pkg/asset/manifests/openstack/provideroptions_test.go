@@ -0,0 +1,115 @@
+package openstack
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/utils/pointer"
+
+	"github.com/openshift/installer/pkg/types"
+	"github.com/openshift/installer/pkg/types/openstack"
+)
+
+func TestNewCloudProviderOptions(t *testing.T) {
+	config := &openstack.CloudProviderConfig{
+		Region: "my_region",
+		Metadata: &openstack.CloudProviderMetadata{
+			SearchOrder: "configDrive",
+		},
+	}
+	zonedPool := func(zones ...string) *openstack.MachinePool {
+		return &openstack.MachinePool{RootVolume: &openstack.RootVolume{Zones: zones}}
+	}
+
+	cases := []struct {
+		name            string
+		installConfig   types.InstallConfig
+		expectedOptions CloudProviderOptions
+	}{
+		{
+			name: "other platform",
+		},
+		{
+			name: "empty platform",
+			installConfig: types.InstallConfig{
+				Platform: types.Platform{OpenStack: &openstack.Platform{}},
+			},
+		},
+		{
+			name: "all settings",
+			installConfig: types.InstallConfig{
+				ControlPlane: &types.MachinePool{
+					Platform: types.MachinePoolPlatform{OpenStack: zonedPool("cinder-az2", "cinder-az1")},
+				},
+				Compute: []types.MachinePool{
+					{Platform: types.MachinePoolPlatform{OpenStack: zonedPool("cinder-az3")}},
+					{Platform: types.MachinePoolPlatform{}},
+				},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						Cloud:               "openstack",
+						CloudProviderConfig: config,
+						ExternalNetwork:     "external",
+						ControlPlanePort: &openstack.PortTarget{
+							Network:  openstack.NetworkFilter{ID: "machines-id"},
+							FixedIPs: []openstack.FixedIP{{Subnet: openstack.SubnetFilter{Name: "machines"}}},
+						},
+						DefaultMachinePlatform: &openstack.MachinePool{
+							NodeVolumeAttachLimit: pointer.Int(25),
+							RootVolume:            &openstack.RootVolume{Zones: []string{"cinder-az1"}},
+						},
+					},
+				},
+			},
+			expectedOptions: CloudProviderOptions{
+				Config:                 config,
+				Cloud:                  "openstack",
+				ExternalNetwork:        "external",
+				MemberSubnet:           "machines",
+				MemberSubnetNetworkID:  "machines-id",
+				MachineSubnet:          "machines",
+				MachineSubnetNetworkID: "machines-id",
+				RootVolumeZones:        []string{"cinder-az1", "cinder-az2", "cinder-az3"},
+				NodeVolumeAttachLimit:  pointer.Int(25),
+			},
+		},
+		{
+			name: "explicit member subnet",
+			installConfig: types.InstallConfig{
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							LoadBalancer: &openstack.CloudProviderLoadBalancer{MemberSubnet: "members"},
+						},
+						DeprecatedMachinesSubnet: "machines",
+					},
+				},
+			},
+			expectedOptions: CloudProviderOptions{
+				Config: &openstack.CloudProviderConfig{
+					LoadBalancer: &openstack.CloudProviderLoadBalancer{MemberSubnet: "members"},
+				},
+				MemberSubnet:  "members",
+				MachineSubnet: "machines",
+			},
+		},
+		{
+			name: "machines subnet",
+			installConfig: types.InstallConfig{
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{DeprecatedMachinesSubnet: "machines"},
+				},
+			},
+			expectedOptions: CloudProviderOptions{
+				MemberSubnet:  "machines",
+				MachineSubnet: "machines",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedOptions, NewCloudProviderOptions(tc.installConfig))
+		})
+	}
+}
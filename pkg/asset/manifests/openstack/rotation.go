@@ -0,0 +1,43 @@
+package openstack
+
+import (
+	"reflect"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+)
+
+// withoutCredentials returns a copy of the cloud without the fields that only
+// end up in the credentials of the system secret, so that the rest of the
+// cloud can be compared.
+func withoutCredentials(cloud *clientconfig.Cloud) clientconfig.Cloud {
+	res := *cloud
+	res.AuthType = ""
+	if cloud.AuthInfo != nil {
+		auth := *cloud.AuthInfo
+		auth.Token = ""
+		auth.Username = ""
+		auth.UserID = ""
+		auth.Password = ""
+		auth.ApplicationCredentialID = ""
+		auth.ApplicationCredentialName = ""
+		auth.ApplicationCredentialSecret = ""
+		res.AuthInfo = &auth
+	}
+	return res
+}
+
+// SecretDataChanged reports whether only the credentials changed between two
+// clouds, such as after the rotation of a password or of an application
+// credential. The system secret then needs to be regenerated, but not the
+// cloud provider config, which only references the secret. It returns false
+// when nothing changed, and when any other field changed, in which case both
+// the secret and the config need to be regenerated.
+func SecretDataChanged(old, new *clientconfig.Cloud) bool {
+	if old == nil || new == nil {
+		return false
+	}
+	if !reflect.DeepEqual(withoutCredentials(old), withoutCredentials(new)) {
+		return false
+	}
+	return !reflect.DeepEqual(old, new)
+}
@@ -0,0 +1,79 @@
+package openstack
+
+import (
+	"testing"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretDataChanged(t *testing.T) {
+	cloud := func(edit func(*clientconfig.Cloud)) *clientconfig.Cloud {
+		res := &clientconfig.Cloud{
+			AuthType: clientconfig.AuthPassword,
+			AuthInfo: &clientconfig.AuthInfo{
+				AuthURL:     "https://my_auth_url.com/v3/",
+				Username:    "my_user",
+				Password:    "my_secret_password",
+				ProjectName: "my_project",
+				DomainName:  "Default",
+			},
+			RegionName: "my_region",
+		}
+		if edit != nil {
+			edit(res)
+		}
+		return res
+	}
+
+	cases := []struct {
+		name     string
+		new      *clientconfig.Cloud
+		expected bool
+	}{
+		{
+			name: "no change",
+			new:  cloud(nil),
+		},
+		{
+			name:     "rotated password",
+			new:      cloud(func(c *clientconfig.Cloud) { c.AuthInfo.Password = "my_new_password" }),
+			expected: true,
+		},
+		{
+			name: "switched to an application credential",
+			new: cloud(func(c *clientconfig.Cloud) {
+				c.AuthType = clientconfig.AuthV3ApplicationCredential
+				c.AuthInfo.Username = ""
+				c.AuthInfo.Password = ""
+				c.AuthInfo.ApplicationCredentialID = "my_app_cred_id"
+				c.AuthInfo.ApplicationCredentialSecret = "my_app_cred_secret"
+			}),
+			expected: true,
+		},
+		{
+			name: "changed region",
+			new:  cloud(func(c *clientconfig.Cloud) { c.RegionName = "my_other_region" }),
+		},
+		{
+			name: "changed project with the password",
+			new: cloud(func(c *clientconfig.Cloud) {
+				c.AuthInfo.Password = "my_new_password"
+				c.AuthInfo.ProjectName = "my_other_project"
+			}),
+		},
+		{
+			name: "removed auth",
+			new:  cloud(func(c *clientconfig.Cloud) { c.AuthInfo = nil }),
+		},
+		{
+			name: "nil cloud",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, SecretDataChanged(cloud(nil), tc.new))
+		})
+	}
+}
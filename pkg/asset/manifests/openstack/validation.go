@@ -0,0 +1,289 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sirupsen/logrus"
+
+	"github.com/openshift/installer/pkg/asset/installconfig/openstack"
+	"github.com/openshift/installer/pkg/types"
+)
+
+// ValidateCloud checks that the given cloud holds the minimum configuration
+// needed by the cloud provider to authenticate against OpenStack: an auth URL
+// and at least one complete authentication method, either a password, a token
+// or an application credential. A password and a token can't be combined, as
+// which one the cloud provider would use is undefined. Keystone trusts are
+// authenticated with the password of the trustee and don't need any
+// additional setting here.
+func ValidateCloud(cloud *clientconfig.Cloud) error {
+	auth := cloud.AuthInfo
+	if auth == nil {
+		auth = new(clientconfig.AuthInfo)
+	}
+
+	if auth.Password != "" && auth.Token != "" {
+		return Error{errors.New("both a password and a token are set, remove one of them"), "conflicting authentication settings in clouds.yaml"}
+	}
+
+	var missing []string
+	if auth.AuthURL == "" {
+		missing = append(missing, "auth_url")
+	}
+
+	switch {
+	case auth.ApplicationCredentialID != "" || auth.ApplicationCredentialName != "" || auth.ApplicationCredentialSecret != "":
+		if auth.ApplicationCredentialID == "" && auth.ApplicationCredentialName == "" {
+			missing = append(missing, "application_credential_id or application_credential_name")
+		}
+		if auth.ApplicationCredentialID == "" && auth.ApplicationCredentialName != "" && auth.Username == "" && auth.UserID == "" {
+			// Application credential names are only unique per user.
+			missing = append(missing, "username or user_id")
+		}
+		if auth.ApplicationCredentialSecret == "" {
+			missing = append(missing, "application_credential_secret")
+		}
+	case auth.Token != "":
+	case auth.Username != "" || auth.UserID != "" || auth.Password != "":
+		if auth.Username == "" && auth.UserID == "" {
+			missing = append(missing, "username or user_id")
+		}
+		if auth.Password == "" {
+			missing = append(missing, "password")
+		}
+	default:
+		missing = append(missing, "password, token or application credential")
+	}
+
+	if len(missing) > 0 {
+		errs := make(Errors, 0, len(missing))
+		for _, field := range missing {
+			errs = append(errs, fmt.Errorf("missing %s", field))
+		}
+		return Error{errs, "incomplete authentication settings in clouds.yaml"}
+	}
+	return nil
+}
+
+// validateAuthURL checks that the auth URL of the given cloud can be parsed
+// and, when a CA bundle is configured, that it uses TLS. The cloud provider
+// would otherwise ignore the pinned CA without any error.
+func validateAuthURL(cloud *clientconfig.Cloud) error {
+	if cloud.AuthInfo == nil || cloud.AuthInfo.AuthURL == "" {
+		return nil
+	}
+
+	authURL, err := url.Parse(cloud.AuthInfo.AuthURL)
+	if err != nil {
+		return Error{err, "invalid auth_url"}
+	}
+	if cloud.CACertFile != "" && strings.EqualFold(authURL.Scheme, "http") {
+		return Error{errors.New("a cacert is configured but the scheme is http"), "invalid auth_url " + withoutUserinfo(authURL)}
+	}
+	return nil
+}
+
+// cloudAuthURL returns the auth URL of the given cloud without the credentials
+// embedded in it, which would otherwise end up in the cloud provider config.
+// In strict mode, such credentials are an error instead. The credentials are
+// never logged nor returned in the error.
+func cloudAuthURL(cloud *clientconfig.Cloud, strict bool) (string, error) {
+	if cloud.AuthInfo == nil || cloud.AuthInfo.AuthURL == "" {
+		return "", nil
+	}
+
+	authURL, err := url.Parse(cloud.AuthInfo.AuthURL)
+	if err != nil {
+		return "", Error{err, "invalid auth_url"}
+	}
+	if authURL.User == nil {
+		return cloud.AuthInfo.AuthURL, nil
+	}
+
+	cleaned := withoutUserinfo(authURL)
+	if strict {
+		return "", Error{errors.New("the URL embeds credentials, set them in the auth settings of clouds.yaml instead"), "invalid auth_url " + cleaned}
+	}
+	logrus.Warnf("Removing the credentials embedded in the auth_url %s, set them in the auth settings of clouds.yaml instead", cleaned)
+	return cleaned, nil
+}
+
+// withoutUserinfo returns the given URL without its userinfo.
+func withoutUserinfo(u *url.URL) string {
+	res := *u
+	res.User = nil
+	return res.String()
+}
+
+// identityVersionPath matches the paths ending with the version of a Keystone
+// API, such as /v3 or /identity/v2.0.
+var identityVersionPath = regexp.MustCompile(`/v[0-9]+(\.[0-9]+)?$`)
+
+// normalizedAuthURL returns the given auth URL without trailing slash. The path
+// of the Keystone API version set by identity_api_version is appended to the
+// URLs that don't end with a version, so that the cloud provider doesn't rely
+// on the version discovery of Keystone. Unparsable URLs are returned as is.
+func normalizedAuthURL(authURL, identityAPIVersion string) string {
+	if authURL == "" {
+		return ""
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		return authURL
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	if !identityVersionPath.MatchString(u.Path) {
+		switch major, _, _ := strings.Cut(strings.TrimPrefix(identityAPIVersion, "v"), "."); major {
+		case "2":
+			u.Path += "/v2.0"
+		case "3":
+			u.Path += "/v3"
+		}
+	}
+	return u.String()
+}
+
+// validateIdentityAPIVersion checks that a cloud pinned to the Keystone v2
+// API doesn't hold any of the settings only Keystone v3 supports, such as
+// domains or application credentials, which would make the generated config
+// contradictory.
+func validateIdentityAPIVersion(cloud *clientconfig.Cloud) error {
+	version := cloud.IdentityAPIVersion
+	if cloud.AuthInfo == nil || (version != "2" && !strings.HasPrefix(version, "2.")) {
+		return nil
+	}
+
+	auth := cloud.AuthInfo
+	var v3Only []string
+	for _, setting := range []struct {
+		name  string
+		value string
+	}{
+		{"domain_id", auth.DomainID},
+		{"domain_name", auth.DomainName},
+		{"default_domain", auth.DefaultDomain},
+		{"user_domain_id", auth.UserDomainID},
+		{"user_domain_name", auth.UserDomainName},
+		{"project_domain_id", auth.ProjectDomainID},
+		{"project_domain_name", auth.ProjectDomainName},
+		{"application_credential_id", auth.ApplicationCredentialID},
+		{"application_credential_name", auth.ApplicationCredentialName},
+		{"application_credential_secret", auth.ApplicationCredentialSecret},
+		{"system_scope", auth.SystemScope},
+	} {
+		if setting.value != "" {
+			v3Only = append(v3Only, setting.name)
+		}
+	}
+
+	if len(v3Only) > 0 {
+		return Error{fmt.Errorf("identity API v3 is required by %s", strings.Join(v3Only, ", ")), "invalid identity_api_version " + version}
+	}
+	return nil
+}
+
+// federatedAuthTypes are the auth types of Keystone federation. They rely on
+// an identity provider and a protocol that the cloud provider has no setting
+// for, so its config can't be generated for them.
+var federatedAuthTypes = map[clientconfig.AuthType]bool{
+	"v3samlpassword":          true,
+	"v3oidcpassword":          true,
+	"v3oidcaccesstoken":       true,
+	"v3oidcclientcredentials": true,
+	"v3oidcauthcode":          true,
+}
+
+// validateAuthType checks that the cloud provider supports the auth type of
+// the given cloud, so that a federated cloud fails instead of producing a
+// secret the cloud provider can't authenticate with.
+func validateAuthType(cloud *clientconfig.Cloud) error {
+	authType := clientconfig.AuthType(strings.ToLower(string(cloud.AuthType)))
+	if federatedAuthTypes[authType] {
+		return Error{errors.New("Keystone federation is not supported yet, use a password or an application credential instead"), "unsupported auth_type " + string(cloud.AuthType)}
+	}
+	return nil
+}
+
+// PreflightCloudProviderConfig runs the checks done while generating the cloud
+// provider config for the OpenStack platform, without generating it: it loads
+// the cloud from clouds.yaml, checks its authentication settings, reads its CA
+// bundle and resolves the Neutron resources referenced by the install config.
+// All the failures are reported at once in the returned error, so that tooling
+// can gate an install on the validity of the config. The Neutron and Keystone
+// requests are bound to ctx.
+func PreflightCloudProviderConfig(ctx context.Context, installConfig types.InstallConfig, opts ...Option) error {
+	session, err := openstack.GetSession(installConfig.Platform.OpenStack.Cloud)
+	if err != nil {
+		return Error{err, "failed to get cloud config for openstack"}
+	}
+
+	newNetworkClient := func() (networkResolver, error) {
+		endpoint, err := networkEndpoint(newOptions(opts).networkEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		networkClient, err := getNetworkClient(session, endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return newNeutronResolver(networkClient, session.CloudConfig), nil
+	}
+	return preflightCloudProviderConfig(ctx, newNetworkClient, session.CloudConfig, installConfig, withCloudsYAMLDir(opts)...)
+}
+
+func preflightCloudProviderConfig(ctx context.Context, newNetworkClient func() (networkResolver, error), cloud *clientconfig.Cloud, installConfig types.InstallConfig, opts ...Option) error {
+	var errs Errors
+
+	authErr := ValidateCloud(cloud)
+	if authErr != nil {
+		errs = append(errs, authErr)
+	}
+
+	// The CA bundle is read here rather than while writing the config, so that
+	// an invalid CA bundle doesn't hide the failures of the Neutron lookups. It
+	// is read and checked the same way as when writing the config.
+	o := newOptions(opts)
+	providerOpts := NewCloudProviderOptions(installConfig)
+	var caBundle string
+	var caErr error
+	switch config := providerOpts.Config; {
+	case config != nil && config.CABundle != "":
+		caBundle, caErr = decodeCABundle(config.CABundle)
+		// The CA bundle is left out of the config written below, which would
+		// report its failure again.
+		withoutBundle := *config
+		withoutBundle.CABundle = ""
+		providerOpts.Config = &withoutBundle
+	case cloud.CACertFile != "":
+		caBundle, caErr = readCABundle(cloud.CACertFile, o)
+	}
+	if caErr == nil {
+		caErr = validateCABundleSize(caBundle, o)
+	}
+	if caErr != nil {
+		errs = append(errs, caErr)
+	}
+
+	// Neutron can't be queried without complete authentication settings.
+	if authErr == nil {
+		networkClient, err := newNetworkClient()
+		if err != nil {
+			errs = append(errs, Error{err, "failed to create a network client"})
+		} else if _, _, err := writeCloudProviderConfig(ctx, io.Discard, networkClient, cloud, providerOpts, append(opts, withoutCABundle())...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return Error{errs, "invalid cloud provider config"}
+	}
+	return nil
+}
@@ -0,0 +1,608 @@
+package openstack
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gophercloud/utils/openstack/clientconfig"
+	"github.com/sirupsen/logrus"
+	logrusTest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/openshift/installer/pkg/types"
+	"github.com/openshift/installer/pkg/types/openstack"
+)
+
+func TestValidateCloud(t *testing.T) {
+	cases := []struct {
+		name          string
+		authInfo      *clientconfig.AuthInfo
+		expectedError string
+	}{
+		{
+			name: "password",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3/",
+				Username: "my_user",
+				Password: "my_secret_password",
+			},
+		},
+		{
+			name: "password with user ID",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3/",
+				UserID:   "my_user_id",
+				Password: "my_secret_password",
+			},
+		},
+		{
+			name: "application credential by ID",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3/",
+				ApplicationCredentialID:     "my_app_cred_id",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+		},
+		{
+			name: "application credential by name",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3/",
+				Username:                    "my_user",
+				ApplicationCredentialName:   "my_app_cred",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+		},
+		{
+			name: "token",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL: "https://my_auth_url.com/v3/",
+				Token:   "my_token",
+			},
+		},
+		{
+			name: "password and token",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3/",
+				Username: "my_user",
+				Password: "my_secret_password",
+				Token:    "my_token",
+			},
+			expectedError: "conflicting authentication settings in clouds.yaml: both a password and a token are set, remove one of them",
+		},
+		{
+			name: "neither password nor token",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL: "https://my_auth_url.com/v3/",
+			},
+			expectedError: "incomplete authentication settings in clouds.yaml: missing password, token or application credential",
+		},
+		{
+			name:          "no auth",
+			expectedError: "incomplete authentication settings in clouds.yaml: missing auth_url\nmissing password, token or application credential",
+		},
+		{
+			name: "missing auth URL",
+			authInfo: &clientconfig.AuthInfo{
+				Username: "my_user",
+				Password: "my_secret_password",
+			},
+			expectedError: "incomplete authentication settings in clouds.yaml: missing auth_url",
+		},
+		{
+			name: "missing password",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:  "https://my_auth_url.com/v3/",
+				Username: "my_user",
+			},
+			expectedError: "incomplete authentication settings in clouds.yaml: missing password",
+		},
+		{
+			name: "missing username",
+			authInfo: &clientconfig.AuthInfo{
+				Password: "my_secret_password",
+			},
+			expectedError: "incomplete authentication settings in clouds.yaml: missing auth_url\nmissing username or user_id",
+		},
+		{
+			name: "missing application credential secret",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                 "https://my_auth_url.com/v3/",
+				ApplicationCredentialID: "my_app_cred_id",
+			},
+			expectedError: "incomplete authentication settings in clouds.yaml: missing application_credential_secret",
+		},
+		{
+			name: "missing application credential ID",
+			authInfo: &clientconfig.AuthInfo{
+				AuthURL:                     "https://my_auth_url.com/v3/",
+				ApplicationCredentialSecret: "my_app_cred_secret",
+			},
+			expectedError: "incomplete authentication settings in clouds.yaml: missing application_credential_id or application_credential_name",
+		},
+		{
+			name: "missing application credential user",
+			authInfo: &clientconfig.AuthInfo{
+				ApplicationCredentialName: "my_app_cred",
+			},
+			expectedError: "incomplete authentication settings in clouds.yaml: missing auth_url\nmissing username or user_id\nmissing application_credential_secret",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateCloud(&clientconfig.Cloud{AuthInfo: tc.authInfo})
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.ErrorAs(t, err, new(Error))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestValidateCloudReportsAllMissingFields(t *testing.T) {
+	err := ValidateCloud(&clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			ApplicationCredentialName: "my_app_cred",
+		},
+	})
+
+	var errs Errors
+	if assert.ErrorAs(t, err, &errs) {
+		assert.Len(t, errs, 3)
+	}
+}
+
+func TestValidateAuthURL(t *testing.T) {
+	cases := []struct {
+		name          string
+		authURL       string
+		caCertFile    string
+		expectedError string
+	}{
+		{
+			name:       "https",
+			authURL:    "https://my_auth_url.com:13000/v3/",
+			caCertFile: "/etc/openstack/ca.pem",
+		},
+		{
+			name:    "http without cacert",
+			authURL: "http://my_auth_url.com:5000/v3/",
+		},
+		{
+			name:          "http with cacert",
+			authURL:       "http://my_auth_url.com:5000/v3/",
+			caCertFile:    "/etc/openstack/ca.pem",
+			expectedError: "invalid auth_url http://my_auth_url.com:5000/v3/: a cacert is configured but the scheme is http",
+		},
+		{
+			name:          "malformed",
+			authURL:       "https://[::1/v3/",
+			expectedError: `invalid auth_url: parse "https://[::1/v3/": missing ']' in host`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   &clientconfig.AuthInfo{AuthURL: tc.authURL},
+				CACertFile: tc.caCertFile,
+			}
+			err := validateAuthURL(&cloud)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCloudAuthURL(t *testing.T) {
+	cases := []struct {
+		name            string
+		authURL         string
+		strict          bool
+		expectedAuthURL string
+		expectedWarning string
+		expectedError   string
+	}{
+		{
+			name:            "without userinfo",
+			authURL:         "https://my_auth_url.com:13000/v3/",
+			expectedAuthURL: "https://my_auth_url.com:13000/v3/",
+		},
+		{
+			name:            "without userinfo in strict mode",
+			authURL:         "https://my_auth_url.com:13000/v3/",
+			strict:          true,
+			expectedAuthURL: "https://my_auth_url.com:13000/v3/",
+		},
+		{
+			name:            "with userinfo",
+			authURL:         "https://my_user:my%40secret@my_auth_url.com:13000/v3/",
+			expectedAuthURL: "https://my_auth_url.com:13000/v3/",
+			expectedWarning: "Removing the credentials embedded in the auth_url https://my_auth_url.com:13000/v3/, set them in the auth settings of clouds.yaml instead",
+		},
+		{
+			name:            "with username only",
+			authURL:         "https://my_user@my_auth_url.com/v3/",
+			expectedAuthURL: "https://my_auth_url.com/v3/",
+			expectedWarning: "Removing the credentials embedded in the auth_url https://my_auth_url.com/v3/, set them in the auth settings of clouds.yaml instead",
+		},
+		{
+			name:          "with userinfo in strict mode",
+			authURL:       "https://my_user:my%40secret@my_auth_url.com:13000/v3/",
+			strict:        true,
+			expectedError: "invalid auth_url https://my_auth_url.com:13000/v3/: the URL embeds credentials, set them in the auth settings of clouds.yaml instead",
+		},
+		{
+			name: "unset",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			hook := logrusTest.NewGlobal()
+			t.Cleanup(hook.Reset)
+
+			cloud := clientconfig.Cloud{
+				AuthInfo: &clientconfig.AuthInfo{AuthURL: tc.authURL},
+			}
+			authURL, err := cloudAuthURL(&cloud, tc.strict)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				assert.NotContains(t, err.Error(), "secret")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedAuthURL, authURL)
+
+			var warnings []string
+			for _, entry := range hook.AllEntries() {
+				if entry.Level == logrus.WarnLevel {
+					warnings = append(warnings, entry.Message)
+				}
+			}
+			if tc.expectedWarning == "" {
+				assert.Empty(t, warnings)
+			} else {
+				assert.Equal(t, []string{tc.expectedWarning}, warnings)
+			}
+		})
+	}
+}
+
+func TestNormalizedAuthURL(t *testing.T) {
+	cases := []struct {
+		name               string
+		authURL            string
+		identityAPIVersion string
+		expectedAuthURL    string
+	}{
+		{
+			name:            "trailing slash",
+			authURL:         "https://my_auth_url.com:13000/v3/",
+			expectedAuthURL: "https://my_auth_url.com:13000/v3",
+		},
+		{
+			name:            "several trailing slashes",
+			authURL:         "https://my_auth_url.com/identity/v3//",
+			expectedAuthURL: "https://my_auth_url.com/identity/v3",
+		},
+		{
+			name:               "explicit version path",
+			authURL:            "https://my_auth_url.com/v3",
+			identityAPIVersion: "3",
+			expectedAuthURL:    "https://my_auth_url.com/v3",
+		},
+		{
+			name:               "explicit version path other than identity_api_version",
+			authURL:            "https://my_auth_url.com/v2.0/",
+			identityAPIVersion: "3",
+			expectedAuthURL:    "https://my_auth_url.com/v2.0",
+		},
+		{
+			name:            "bare host",
+			authURL:         "https://my_auth_url.com:5000/",
+			expectedAuthURL: "https://my_auth_url.com:5000",
+		},
+		{
+			name:               "bare host with identity_api_version",
+			authURL:            "https://my_auth_url.com:5000/",
+			identityAPIVersion: "3",
+			expectedAuthURL:    "https://my_auth_url.com:5000/v3",
+		},
+		{
+			name:               "path prefix with identity_api_version",
+			authURL:            "https://my_auth_url.com/identity",
+			identityAPIVersion: "v3",
+			expectedAuthURL:    "https://my_auth_url.com/identity/v3",
+		},
+		{
+			name:               "bare host with Keystone v2",
+			authURL:            "https://my_auth_url.com:5000",
+			identityAPIVersion: "2.0",
+			expectedAuthURL:    "https://my_auth_url.com:5000/v2.0",
+		},
+		{
+			name:               "bare host with unknown identity_api_version",
+			authURL:            "https://my_auth_url.com:5000",
+			identityAPIVersion: "4",
+			expectedAuthURL:    "https://my_auth_url.com:5000",
+		},
+		{
+			name: "unset",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedAuthURL, normalizedAuthURL(tc.authURL, tc.identityAPIVersion))
+		})
+	}
+}
+
+func TestCloudProviderConfigSecretAuthURLNormalization(t *testing.T) {
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://my_auth_url.com:5000/",
+			Username: "my_user",
+			Password: "my_secret_password",
+		},
+		IdentityAPIVersion: "3",
+	}
+
+	secretConfig, err := CloudProviderConfigSecret(&cloud)
+	assert.NoError(t, err, "failed to create cloud provider config")
+	assert.Contains(t, string(secretConfig), "auth-url = \"https://my_auth_url.com:5000/v3\"\n")
+
+	secretJSON, err := CloudProviderConfigSecretJSON(&cloud)
+	assert.NoError(t, err, "failed to create cloud provider config")
+	assert.Contains(t, string(secretJSON), `"auth-url":"https://my_auth_url.com:5000/v3"`)
+
+	secretConfig, err = CloudProviderConfigSecret(&cloud, WithAuthURLNormalization(false))
+	assert.NoError(t, err, "failed to create cloud provider config")
+	assert.Contains(t, string(secretConfig), "auth-url = \"https://my_auth_url.com:5000/\"\n")
+}
+
+func TestCloudProviderConfigSecretAuthURLUserinfo(t *testing.T) {
+	cloud := clientconfig.Cloud{
+		AuthInfo: &clientconfig.AuthInfo{
+			AuthURL:  "https://my_user:my_secret_password@my_auth_url.com/v3/",
+			Username: "my_user",
+			Password: "my_secret_password",
+		},
+	}
+
+	secretConfig, err := CloudProviderConfigSecret(&cloud)
+	assert.NoError(t, err, "failed to create cloud provider config")
+	assert.Equal(t, `[Global]
+auth-url = "https://my_auth_url.com/v3"
+username = "my_user"
+password = "my_secret_password"
+`, string(secretConfig), "unexpected cloud provider config")
+
+	_, err = CloudProviderConfigSecret(&cloud, WithStrict(true))
+	assert.EqualError(t, err, "invalid auth_url https://my_auth_url.com/v3/: the URL embeds credentials, set them in the auth settings of clouds.yaml instead")
+
+	_, err = CloudProviderConfigSecretMulti(map[string]*clientconfig.Cloud{"openstack": &cloud}, WithStrict(true))
+	assert.EqualError(t, err, `invalid clouds: cloud "openstack": invalid auth_url https://my_auth_url.com/v3/: the URL embeds credentials, set them in the auth settings of clouds.yaml instead`)
+}
+
+func TestValidateIdentityAPIVersion(t *testing.T) {
+	cases := []struct {
+		name          string
+		version       string
+		authInfo      clientconfig.AuthInfo
+		expectedError string
+	}{
+		{
+			name:     "v3 with domains",
+			version:  "3",
+			authInfo: clientconfig.AuthInfo{DomainName: "Default", ProjectDomainID: "default"},
+		},
+		{
+			name:     "unset with application credential",
+			authInfo: clientconfig.AuthInfo{ApplicationCredentialID: "my_app_cred_id", ApplicationCredentialSecret: "my_app_cred_secret"},
+		},
+		{
+			name:     "v2 without v3 settings",
+			version:  "2",
+			authInfo: clientconfig.AuthInfo{Username: "my_user", Password: "my_secret_password", ProjectName: "my_project"},
+		},
+		{
+			name:          "v2 with domain",
+			version:       "2",
+			authInfo:      clientconfig.AuthInfo{Username: "my_user", Password: "my_secret_password", DomainName: "Default"},
+			expectedError: "invalid identity_api_version 2: identity API v3 is required by domain_name",
+		},
+		{
+			name:          "v2.0 with user domain and application credential",
+			version:       "2.0",
+			authInfo:      clientconfig.AuthInfo{UserDomainID: "default", ApplicationCredentialID: "my_app_cred_id", ApplicationCredentialSecret: "my_app_cred_secret"},
+			expectedError: "invalid identity_api_version 2.0: identity API v3 is required by user_domain_id, application_credential_id, application_credential_secret",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:           &tc.authInfo,
+				IdentityAPIVersion: tc.version,
+			}
+			err := validateIdentityAPIVersion(&cloud)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{},
+				},
+			}
+			_, _, err = generateCloudProviderConfig(context.Background(), nil, &cloud, NewCloudProviderOptions(installConfig))
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestPreflightCloudProviderConfig(t *testing.T) {
+	resolver := fakeNetworkResolver{
+		networks: []fakeNetwork{
+			{ID: "a0ea6cd1-2e36-4e2a-9b9a-8b3d8c1e3a11", Name: "external", External: true},
+		},
+	}
+	fsys := fstest.MapFS{
+		"etc/openstack/ca.pem": {Data: []byte(testCACert)},
+	}
+	validAuth := &clientconfig.AuthInfo{
+		AuthURL:  "https://my_auth_url.com/v3/",
+		Username: "my_user",
+		Password: "my_secret_password",
+	}
+
+	cases := []struct {
+		name            string
+		authInfo        *clientconfig.AuthInfo
+		caCertFile      string
+		caBundle        string
+		externalNetwork string
+		clientErr       error
+		opts            []Option
+		expectedError   string
+	}{
+		{
+			name:            "valid",
+			authInfo:        validAuth,
+			caCertFile:      "/etc/openstack/ca.pem",
+			externalNetwork: "external",
+		},
+		{
+			name:          "incomplete authentication",
+			authInfo:      &clientconfig.AuthInfo{Username: "my_user"},
+			expectedError: "invalid cloud provider config: incomplete authentication settings in clouds.yaml: missing auth_url\nmissing password",
+		},
+		{
+			name:          "unreadable CA",
+			authInfo:      validAuth,
+			caCertFile:    "/etc/openstack/missing.pem",
+			expectedError: "invalid cloud provider config: failed to read clouds.yaml ca-cert at etc/openstack/missing.pem: open etc/openstack/missing.pem: file does not exist",
+		},
+		{
+			name:            "valid inline CA",
+			authInfo:        validAuth,
+			caBundle:        base64.StdEncoding.EncodeToString([]byte(testCACert)),
+			externalNetwork: "external",
+		},
+		{
+			name:            "invalid inline CA",
+			authInfo:        validAuth,
+			caBundle:        "not base64",
+			externalNetwork: "missing",
+			expectedError: "invalid cloud provider config: invalid CA bundle of the cloud provider config: illegal base64 data at input byte 3\n" +
+				"failed to find external network missing: no network found",
+		},
+		{
+			name:          "CA over the size limit",
+			authInfo:      validAuth,
+			caCertFile:    "/etc/openstack/ca.pem",
+			opts:          []Option{WithMaxCABundleSize(len(testCACert) - 1)},
+			expectedError: fmt.Sprintf("invalid cloud provider config: invalid CA bundle: the bundle is %d bytes, over the limit of %d bytes", len(testCACert), len(testCACert)-1),
+		},
+		{
+			name:          "inline CA over the size limit",
+			authInfo:      validAuth,
+			caBundle:      base64.StdEncoding.EncodeToString([]byte(testCACert)),
+			opts:          []Option{WithMaxCABundleSize(len(testCACert) - 1)},
+			expectedError: fmt.Sprintf("invalid cloud provider config: invalid CA bundle: the bundle is %d bytes, over the limit of %d bytes", len(testCACert), len(testCACert)-1),
+		},
+		{
+			name:            "unresolvable external network",
+			authInfo:        validAuth,
+			externalNetwork: "missing",
+			expectedError:   "invalid cloud provider config: failed to find external network missing: no network found",
+		},
+		{
+			name:            "network client failure",
+			authInfo:        validAuth,
+			externalNetwork: "external",
+			clientErr:       errors.New("no network endpoint"),
+			expectedError:   "invalid cloud provider config: failed to create a network client: no network endpoint",
+		},
+		{
+			name:            "several failures",
+			authInfo:        validAuth,
+			caCertFile:      "/etc/openstack/missing.pem",
+			externalNetwork: "missing",
+			expectedError: "invalid cloud provider config: failed to read clouds.yaml ca-cert at etc/openstack/missing.pem: open etc/openstack/missing.pem: file does not exist\n" +
+				"failed to find external network missing: no network found",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cloud := clientconfig.Cloud{
+				AuthInfo:   tc.authInfo,
+				CACertFile: tc.caCertFile,
+			}
+			installConfig := types.InstallConfig{
+				Networking: &types.Networking{},
+				Platform: types.Platform{
+					OpenStack: &openstack.Platform{
+						ExternalNetwork: tc.externalNetwork,
+						CloudProviderConfig: &openstack.CloudProviderConfig{
+							CABundle: tc.caBundle,
+						},
+					},
+				},
+			}
+			newNetworkClient := func() (networkResolver, error) {
+				if tc.clientErr != nil {
+					return nil, tc.clientErr
+				}
+				return resolver, nil
+			}
+
+			err := preflightCloudProviderConfig(context.Background(), newNetworkClient, &cloud, installConfig, append([]Option{WithFS(fsys)}, tc.opts...)...)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPreflightCloudProviderConfigMissingCloud(t *testing.T) {
+	cloudsYAML := filepath.Join(t.TempDir(), "clouds.yaml")
+	err := os.WriteFile(cloudsYAML, []byte("clouds:\n  other:\n    auth:\n      auth_url: https://my_auth_url.com/v3/\n"), 0o600)
+	assert.NoError(t, err)
+	t.Setenv("OS_CLIENT_CONFIG_FILE", cloudsYAML)
+
+	installConfig := types.InstallConfig{
+		Networking: &types.Networking{},
+		Platform: types.Platform{
+			OpenStack: &openstack.Platform{
+				Cloud: "missing",
+			},
+		},
+	}
+
+	err = PreflightCloudProviderConfig(context.Background(), installConfig)
+	assert.ErrorContains(t, err, "failed to get cloud config for openstack")
+}
@@ -0,0 +1,281 @@
+package openstack
+
+// CloudProviderConfig holds the settings that the installer writes to the
+// cloud provider configuration consumed by the OpenStack cloud controller
+// manager.
+type CloudProviderConfig struct {
+	// SecretName is the name of the secret the cloud provider reads its
+	// credentials from. Defaults to openstack-credentials. The installer
+	// creates a copy of its credentials secret under this name, except in the
+	// Manual credentials mode, where the secret must be provided.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+
+	// SecretNamespace is the namespace of the secret the cloud provider reads
+	// its credentials from. Defaults to kube-system, or to
+	// openshift-cloud-controller-manager for the external cloud controller
+	// manager. The installer creates a copy of its credentials secret in this
+	// namespace like for SecretName, but not the namespace itself: a namespace
+	// that doesn't exist in a new cluster must be created by a manifest.
+	// +optional
+	SecretNamespace string `json:"secretNamespace,omitempty"`
+
+	// Region is the region the cloud provider manages resources in. It
+	// defaults to the region of the cloud in clouds.yaml, which may not be the
+	// one the cluster runs in for clouds with multiple regions.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// EndpointType is the interface of the endpoints of the service catalog
+	// the cloud provider uses, for clusters that can only reach the internal
+	// endpoints. The cloud provider uses the public endpoints when unset.
+	// +kubebuilder:validation:Enum="";public;internal;admin
+	// +optional
+	EndpointType string `json:"endpointType,omitempty"`
+
+	// IdentityAPIVersion pins the version of the Keystone API the cloud
+	// provider authenticates with, for clouds where the version negotiation
+	// fails. It replaces the identity_api_version of clouds.yaml when set,
+	// and the cloud provider negotiates the version when unset.
+	// +kubebuilder:validation:Enum="";"2";"3"
+	// +optional
+	IdentityAPIVersion string `json:"identityAPIVersion,omitempty"`
+
+	// CABundle is the base64-encoded PEM bundle of the CA certificates the
+	// cloud provider trusts, for installs that can't reference a file from
+	// clouds.yaml. It replaces the ca-cert of clouds.yaml in the cloud
+	// provider configuration when set.
+	// +optional
+	CABundle string `json:"caBundle,omitempty"`
+
+	// Networking configures how the cloud provider classifies node addresses.
+	// +optional
+	Networking *CloudProviderNetworking `json:"networking,omitempty"`
+
+	// LoadBalancer configures how the cloud provider interacts with Octavia.
+	// +optional
+	LoadBalancer *CloudProviderLoadBalancer `json:"loadBalancer,omitempty"`
+
+	// BlockStorage configures how the cloud provider interacts with Cinder.
+	// +optional
+	BlockStorage *CloudProviderBlockStorage `json:"blockStorage,omitempty"`
+
+	// Metadata configures how the cloud provider reads instance metadata.
+	// +optional
+	Metadata *CloudProviderMetadata `json:"metadata,omitempty"`
+
+	// Route configures the router the cloud provider programs the routes of
+	// the nodes on.
+	// +optional
+	Route *CloudProviderRoute `json:"route,omitempty"`
+}
+
+// CloudProviderNetworking holds the settings of the Networking section of
+// the cloud provider configuration.
+type CloudProviderNetworking struct {
+	// PublicNetworkNames are the names of the Neutron networks whose
+	// addresses are reported as external addresses of the nodes.
+	// +optional
+	PublicNetworkNames []string `json:"publicNetworkNames,omitempty"`
+
+	// PublicNetworkFromExternalNetwork makes the cloud provider also report
+	// the addresses of the nodes on ExternalNetwork as external addresses,
+	// as if it were listed in PublicNetworkNames. It has no effect when
+	// ExternalNetwork is unset.
+	// +optional
+	PublicNetworkFromExternalNetwork bool `json:"publicNetworkFromExternalNetwork,omitempty"`
+
+	// InternalNetworkNames are the names of the Neutron networks whose
+	// addresses are reported as internal addresses of the nodes.
+	// +optional
+	InternalNetworkNames []string `json:"internalNetworkNames,omitempty"`
+
+	// InternalNetworkFromMachineSubnet makes the cloud provider also report
+	// the addresses of the nodes on the network of the machine subnet as
+	// internal addresses, as if it were listed in InternalNetworkNames. It
+	// has no effect when the install config sets no machine subnet.
+	// +optional
+	InternalNetworkFromMachineSubnet bool `json:"internalNetworkFromMachineSubnet,omitempty"`
+
+	// IPv6SupportDisabled makes the cloud provider ignore the IPv6 addresses
+	// of the nodes. The cloud provider default applies when unset.
+	// +optional
+	IPv6SupportDisabled *bool `json:"ipv6SupportDisabled,omitempty"`
+
+	// AddressSortOrder is a comma-separated list of CIDRs used to sort the
+	// addresses of the nodes, so that the internal address of a node with
+	// multiple interfaces is chosen deterministically.
+	// +optional
+	AddressSortOrder string `json:"addressSortOrder,omitempty"`
+}
+
+// CloudProviderLoadBalancer holds the settings of the LoadBalancer section
+// of the cloud provider configuration.
+type CloudProviderLoadBalancer struct {
+	// Disabled keeps the cloud provider from managing load balancers, for
+	// clusters whose load balancer services are served by an external load
+	// balancer. The external network isn't resolved, and none of the other
+	// load balancer settings can be set along with it.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
+	// UseOctavia makes the cloud provider create load balancers with Octavia.
+	// When disabled, the cloud provider falls back to Neutron LBaaS, which
+	// doesn't support the Octavia-only settings such as Provider. The cloud
+	// provider uses Octavia when unset.
+	// +optional
+	UseOctavia *bool `json:"useOctavia,omitempty"`
+
+	// Provider is the Octavia provider used to create load balancers.
+	// Octavia uses the amphora provider when unset.
+	// +kubebuilder:validation:Enum="";amphora;ovn
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// Method is the load balancing algorithm of the pools of the load
+	// balancers. The cloud provider default applies when unset.
+	// +kubebuilder:validation:Enum="";ROUND_ROBIN;LEAST_CONNECTIONS;SOURCE_IP
+	// +optional
+	Method string `json:"method,omitempty"`
+
+	// InternalLB makes the cloud provider create internal load balancers,
+	// without any floating IP. It is meant for clusters without an external
+	// network and conflicts with ExternalNetwork.
+	// +optional
+	InternalLB bool `json:"internalLB,omitempty"`
+
+	// AdditionalExternalNetworks are the names or IDs of other external
+	// networks the floating IPs of the load balancers can be allocated from.
+	// The cloud provider only uses ExternalNetwork, which they require, so
+	// they are only validated.
+	// +optional
+	AdditionalExternalNetworks []string `json:"additionalExternalNetworks,omitempty"`
+
+	// FloatingSubnet is the name, ID or CIDR of the subnet of the external
+	// network from which the floating IPs of the load balancers are allocated.
+	// Requires ExternalNetwork to be set.
+	// +optional
+	FloatingSubnet string `json:"floatingSubnet,omitempty"`
+
+	// FloatingSubnetTag is the Neutron tag of the subnet of the external
+	// network from which the floating IPs of the load balancers are
+	// allocated, for clouds where the floating subnets are tagged. Exactly
+	// one subnet of the external network must have the tag. Requires
+	// ExternalNetwork to be set and conflicts with FloatingSubnet.
+	// +optional
+	FloatingSubnetTag string `json:"floatingSubnetTag,omitempty"`
+
+	// MemberSubnet is the name or ID of the subnet of the nodes in which
+	// Octavia places the members of the load balancers, for clusters whose
+	// nodes have several subnets. It defaults to the subnet of the control
+	// plane port, or to the machines subnet, when one is set.
+	// +optional
+	MemberSubnet string `json:"memberSubnet,omitempty"`
+
+	// ManageSecurityGroups makes the cloud provider manage the security
+	// groups that allow the load balancer traffic to reach the nodes.
+	// Requires ExternalNetwork to be set when enabled.
+	// +optional
+	ManageSecurityGroups *bool `json:"manageSecurityGroups,omitempty"`
+
+	// EnableIngressHostname makes the cloud provider report a hostname instead
+	// of an IP address in the status of the load balancer services, which
+	// keeps the traffic of the cluster going through the load balancer.
+	// +optional
+	EnableIngressHostname bool `json:"enableIngressHostname,omitempty"`
+
+	// IngressHostnameSuffix is the DNS suffix of the hostnames reported when
+	// EnableIngressHostname is set. The cloud provider uses nip.io when unset.
+	// +optional
+	IngressHostnameSuffix string `json:"ingressHostnameSuffix,omitempty"`
+
+	// MaxSharedLB is the maximum number of services that can share a single
+	// load balancer. The cloud provider default applies when unset.
+	// +optional
+	MaxSharedLB *int `json:"maxSharedLB,omitempty"`
+
+	// CreateMonitor makes the cloud provider create health monitors for the
+	// pools of the load balancers.
+	// +optional
+	CreateMonitor *bool `json:"createMonitor,omitempty"`
+
+	// MonitorDelay is the interval between two health checks, as a duration
+	// such as "5s".
+	// +optional
+	MonitorDelay string `json:"monitorDelay,omitempty"`
+
+	// MonitorTimeout is the time a health check waits for a reply, as a
+	// duration such as "3s".
+	// +optional
+	MonitorTimeout string `json:"monitorTimeout,omitempty"`
+
+	// MonitorMaxRetries is the number of successful health checks before a
+	// member is considered online.
+	// +optional
+	MonitorMaxRetries *int `json:"monitorMaxRetries,omitempty"`
+}
+
+// CloudProviderBlockStorage holds the settings of the BlockStorage section
+// of the cloud provider configuration.
+type CloudProviderBlockStorage struct {
+	// BSVersion pins the version of the Cinder API used by the cloud provider,
+	// for clouds where the automatic detection picks the wrong one. The cloud
+	// provider detects the version automatically when unset or set to auto.
+	// +kubebuilder:validation:Enum="";v2;v3;auto
+	// +optional
+	BSVersion string `json:"bsVersion,omitempty"`
+
+	// IgnoreVolumeAZ makes the cloud provider ignore the availability zone
+	// of Cinder volumes when attaching them to instances, for clouds where
+	// Nova has availability zones but Cinder doesn't. It conflicts with the
+	// root volume zones of the machine pools.
+	// +optional
+	IgnoreVolumeAZ bool `json:"ignoreVolumeAZ,omitempty"`
+
+	// AvailabilityZone is the Cinder availability zone the cloud provider
+	// creates volumes in, for clouds whose Cinder availability zones don't
+	// match the Nova ones. It conflicts with IgnoreVolumeAZ.
+	// +optional
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+
+	// TrustDevicePath makes the cloud provider trust the block device names
+	// reported by Cinder instead of looking up the device by serial number,
+	// which saves the lookups on clouds where the device names are stable.
+	// Enabling it is unsafe on clouds where the guest can name the devices
+	// differently from Cinder, such as with some virtio setups: the cloud
+	// provider would then mount the wrong volume.
+	// +optional
+	TrustDevicePath bool `json:"trustDevicePath,omitempty"`
+
+	// NodeVolumeAttachLimit is the maximum number of Cinder volumes that can
+	// be attached to a single node, between 1 and 256. It must match the
+	// limit of the default machine platform when both are set.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=256
+	// +optional
+	NodeVolumeAttachLimit *int `json:"nodeVolumeAttachLimit,omitempty"`
+}
+
+// CloudProviderMetadata holds the settings of the Metadata section of the
+// cloud provider configuration.
+type CloudProviderMetadata struct {
+	// SearchOrder is a comma-separated list of the sources the cloud provider
+	// reads instance metadata from, in order of preference. Valid sources are
+	// configDrive and metadataService.
+	// +optional
+	SearchOrder string `json:"searchOrder,omitempty"`
+
+	// RequestTimeout is the timeout of the requests to the metadata service,
+	// as a duration such as "30s" or "1m".
+	// +optional
+	RequestTimeout string `json:"requestTimeout,omitempty"`
+}
+
+// CloudProviderRoute holds the settings of the Route section of the cloud
+// provider configuration.
+type CloudProviderRoute struct {
+	// Router is the name or ID of the Neutron router on which the cloud
+	// provider programs the routes to the pod networks of the nodes.
+	// +optional
+	Router string `json:"router,omitempty"`
+}
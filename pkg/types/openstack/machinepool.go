@@ -31,6 +31,16 @@ type MachinePool struct {
 	// If no zones are provided, all instances will be deployed on OpenStack Nova default availability zone
 	// +optional
 	Zones []string `json:"zones,omitempty"`
+
+	// NodeVolumeAttachLimit is the maximum number of Cinder volumes that can
+	// be attached to a single node, between 1 and 256. The cloud provider
+	// applies a single limit to the whole cluster, so it is only read from
+	// the default machine platform and can't be overridden per machine pool
+	// yet.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=256
+	// +optional
+	NodeVolumeAttachLimit *int `json:"nodeVolumeAttachLimit,omitempty"`
 }
 
 // Set sets the values from `required` to `o`.
@@ -130,4 +130,9 @@ type Platform struct {
 	// LoadBalancer defines how the load balancer used by the cluster is configured.
 	// +optional
 	LoadBalancer *configv1.OpenStackPlatformLoadBalancer `json:"loadBalancer,omitempty"`
+
+	// CloudProviderConfig holds additional settings for the cloud provider
+	// configuration generated for the cluster.
+	// +optional
+	CloudProviderConfig *CloudProviderConfig `json:"cloudProviderConfig,omitempty"`
 }
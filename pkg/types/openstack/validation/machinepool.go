@@ -25,6 +25,10 @@ func ValidateMachinePool(_ *openstack.Platform, machinePool *openstack.MachinePo
 		errs = append(errs, field.NotSupported(fldPath.Child("serverGroupPolicy"), machinePool.ServerGroupPolicy, validServerGroupPolicies))
 	}
 
+	if machinePool.NodeVolumeAttachLimit != nil && role != "default" {
+		errs = append(errs, field.Forbidden(fldPath.Child("nodeVolumeAttachLimit"), "the node volume attach limit applies to the whole cluster and can only be set on the default machine platform"))
+	}
+
 	if machinePool.RootVolume != nil {
 		if len(machinePool.Zones) > 0 && len(machinePool.RootVolume.Zones) == 0 {
 			errs = append(errs, field.Required(fldPath.Child("rootVolume").Child("zones"), "root volume availability zones must be specified when compute availability zones are specified"))
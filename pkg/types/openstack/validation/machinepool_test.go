@@ -21,6 +21,10 @@ func withAvailabilityZone(zones []string) func(*openstack.MachinePool) {
 	return func(mp *openstack.MachinePool) { mp.Zones = zones }
 }
 
+func withNodeVolumeAttachLimit(limit int) func(*openstack.MachinePool) {
+	return func(mp *openstack.MachinePool) { mp.NodeVolumeAttachLimit = &limit }
+}
+
 func testMachinePool(options ...func(*openstack.MachinePool)) *openstack.MachinePool {
 	var mp openstack.MachinePool
 	for _, apply := range options {
@@ -145,6 +149,21 @@ func TestValidateMachinePool(t *testing.T) {
 				exactlyNErrors(1),
 			),
 		},
+		{
+			"with node volume attach limit on the default machine platform",
+			testMachinePool(withNodeVolumeAttachLimit(25)),
+			"default",
+			check(noError),
+		},
+		{
+			"with node volume attach limit on a compute pool",
+			testMachinePool(withNodeVolumeAttachLimit(25)),
+			"worker",
+			check(
+				someErrorType(field.ErrorTypeForbidden),
+				exactlyNErrors(1),
+			),
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			errs := ValidateMachinePool(nil, tc.machinePool, tc.role, nil)